@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var defaultChoices = map[reflect.Type][]string{}
+
+// RegisterChoices sets the only values allowed for fields of the given
+// type, typically a named string type used as an enum, e.g.
+//
+//	type LogLevel string
+//
+//	conflag.RegisterChoices(reflect.TypeOf(LogLevel("")), "debug", "info", "error")
+//
+// Every field of the type, including slice elements and map values,
+// will then behave as if Choices had been called on it.  Registration
+// is not safe for concurrent use, and should happen before any Config
+// is created, e.g. in an init function.
+func RegisterChoices(t reflect.Type, choices ...string) {
+	defaultChoices[t] = choices
+}
+
+// Finds the choices registered for the type of value a field holds,
+// or the type of its elements for slice and map fields
+func registeredChoices(f *Field) []string {
+	t := f.valueType()
+	if f.kind == sliceFieldType || f.kind == mapFieldType {
+		t = t.Elem()
+	}
+	return defaultChoices[t]
+}
+
+// Checks a single raw value, or a single element or map value for
+// slice and map fields, against the field's choices
+func (f *Field) checkChoice(value string) error {
+	if len(f.choices) == 0 {
+		return nil
+	}
+	for _, choice := range f.choices {
+		if value == choice {
+			return nil
+		}
+	}
+	return fmt.Errorf(
+		"%s isn't an allowed value; choose one of %s",
+		value,
+		strings.Join(f.choices, ", "),
+	)
+}
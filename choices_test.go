@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	. "gopkg.in/check.v1"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type ChoicesSuite struct{}
+
+func TestChoices(t *testing.T) {
+	Suite(&ChoicesSuite{})
+	TestingT(t)
+}
+
+type testBackend string
+
+func (s *ChoicesSuite) TestFieldChoices(c *C) {
+	dest := &struct {
+		Level  string `conflag:"choices=debug|info|error"`
+		Levels []string
+		Limits map[string]int
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.Field("Levels").Choices("debug", "info")
+	config.Field("Limits").Choices("1", "2")
+
+	config.Args(
+		[]string{"--level", "info", "--levels", "info,debug", "--limits", "a=2"},
+	)
+	_, err = config.Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Level, Equals, "info")
+	c.Assert(dest.Levels, DeepEquals, []string{"info", "debug"})
+	c.Assert(dest.Limits, DeepEquals, map[string]int{"a": 2})
+
+	for args, message := range map[string]string{
+		"--level loud": "conflag: Invalid value for Level from the " +
+			"command line: loud isn't an allowed value; choose one of " +
+			"debug, info, error.",
+		"--levels info,loud": "conflag: Element 2 of Levels from the " +
+			"command line: loud isn't an allowed value; choose one of " +
+			"debug, info.",
+		"--limits a=3": "conflag: Value of entry 1 of Limits from the " +
+			"command line: 3 isn't an allowed value; choose one of 1, 2.",
+	} {
+		config, err := New(dest)
+		c.Assert(err, IsNil)
+		config.Field("Levels").Choices("debug", "info")
+		config.Field("Limits").Choices("1", "2")
+		_, err = config.Args(strings.Fields(args)).Read()
+		c.Assert(err, NotNil)
+		c.Assert(err.Error(), Equals, message)
+	}
+}
+
+func (s *ChoicesSuite) TestRegisteredChoices(c *C) {
+	RegisterChoices(reflect.TypeOf(testBackend("")), "s3", "gcs")
+	defer delete(defaultChoices, reflect.TypeOf(testBackend("")))
+
+	dest := &struct {
+		Backend  testBackend
+		Backends []testBackend
+		Fallback *testBackend
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	c.Assert(config.Field("Backend").choices, DeepEquals, []string{"s3", "gcs"})
+	c.Assert(config.Field("Backends").choices, DeepEquals, []string{"s3", "gcs"})
+	c.Assert(config.Field("Fallback").choices, DeepEquals, []string{"s3", "gcs"})
+
+	_, err = config.Args([]string{"--backend", "gcs"}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Backend, Equals, testBackend("gcs"))
+
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	_, err = config.Args([]string{"--backend", "azure"}).Read()
+	c.Assert(err, NotNil)
+}
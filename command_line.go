@@ -37,6 +37,8 @@ import (
 	"fmt"
 )
 
+const commandLineSource = "the command line"
+
 func readCommandLineFlags(
 	dest map[string]*Field,
 	src []string,
@@ -44,6 +46,9 @@ func readCommandLineFlags(
 ) ([]string, error) {
 	fieldsByShortFlag, fieldsByLongFlag := buildFlagIndices(dest)
 	extraArgs := make([]string, 0)
+	for _, field := range dest {
+		field.count, field.counted = 0, false
+	}
 
 	for i := 0; i < len(src); i++ {
 		if len(src[i]) > 2 && src[i][0:2] == "--" {
@@ -51,19 +56,24 @@ func readCommandLineFlags(
 			if !ok {
 				return nil, fmt.Errorf("Unexpected flag %s", src[i][2:])
 			}
-			field.found = true
-			if field.kind == boolFieldType {
+			if field.counter {
+				if src[i][2:] == field.longFlag {
+					field.addCount(1)
+				} else {
+					field.addCount(-1)
+				}
+			} else if field.isBoolean() {
 				if src[i][2:] == field.longFlag {
-					field.parsedValue = "true"
+					field.setValue(commandLineSource, "true")
 				} else {
-					field.parsedValue = "false"
+					field.setValue(commandLineSource, "false")
 				}
 			} else {
 				i++
 				if i >= len(src) {
 					return nil, errors.New("Expected argument to last flag")
 				}
-				field.parsedValue = src[i]
+				field.setValue(commandLineSource, src[i])
 			}
 		} else if len(src[i]) > 1 && src[i][0:1] == "-" {
 			deltaI := 0
@@ -73,12 +83,17 @@ func readCommandLineFlags(
 					err := fmt.Errorf("Unexpected flag %s", string([]rune{v}))
 					return nil, err
 				}
-				field.found = true
-				if field.kind == boolFieldType {
+				if field.counter {
+					if field.shortFlag == v {
+						field.addCount(1)
+					} else {
+						field.addCount(-1)
+					}
+				} else if field.isBoolean() {
 					if field.shortFlag == v {
-						field.parsedValue = "true"
+						field.setValue(commandLineSource, "true")
 					} else {
-						field.parsedValue = "false"
+						field.setValue(commandLineSource, "false")
 					}
 				} else {
 					if deltaI == 0 {
@@ -87,7 +102,7 @@ func readCommandLineFlags(
 					if i+1 >= len(src) {
 						return nil, errors.New("Expected argument to last flag")
 					}
-					field.parsedValue = src[i+1]
+					field.setValue(commandLineSource, src[i+1])
 				}
 			}
 			i += deltaI
@@ -33,7 +33,10 @@
 package conflag
 
 import (
+	"fmt"
 	. "gopkg.in/check.v1"
+	"math"
+	"strings"
 	"testing"
 )
 
@@ -188,3 +191,108 @@ func (s *CommandLineSuite) TestLongFlagCollisionError(c *C) {
 		false,
 	)
 }
+
+func (s *CommandLineSuite) TestRepeatedSliceFlags(c *C) {
+	dest := &struct{ Peers []string }{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.Field("Peers").ShortFlag('p')
+	config.fields["Peers"].setValue(configFileSource, "from-file")
+
+	extras, err := readCommandLineFlags(
+		config.fields,
+		[]string{"-p", "a", "--peers", "b,c"},
+		false,
+	)
+	c.Assert(err, IsNil)
+	c.Assert(len(extras), Equals, 0)
+	c.Assert(
+		config.fields["Peers"].parsedValues,
+		DeepEquals,
+		[]string{"a", "b,c"},
+	)
+}
+
+func (s *CommandLineSuite) TestCounterFlags(c *C) {
+	dest := &struct {
+		Verbosity int `conflag:"short=v,counter,inverse-short=q,inverse=quiet"`
+		Level     uint8
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.Field("Level").ShortFlag('l').Counter()
+
+	_, err = config.Args([]string{"-vvv", "--verbosity", "-q", "-ll"}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Verbosity, Equals, 3)
+	c.Assert(dest.Level, Equals, uint8(2))
+
+	dest.Verbosity, dest.Level = 0, 0
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	config.Field("Level").ShortFlag('l').Counter().InverseShortFlag('m')
+	config.ConfigReader(strings.NewReader("verbosity = 2\nlevel = 1"))
+	_, err = config.Args([]string{"-qqq", "--quiet", "-mmm"}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Verbosity, Equals, -2)
+	c.Assert(dest.Level, Equals, uint8(0))
+
+	dest.Level = 255
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	config.Field("Level").ShortFlag('l').Counter()
+	_, err = config.Args([]string{"-l"}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Invalid value for Level from the command line: "+
+			"Count 1 is out of range starting at 255.",
+	)
+
+	dest.Verbosity = math.MaxInt
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	_, err = config.Args([]string{"-v"}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		fmt.Sprintf(
+			"conflag: Invalid value for Verbosity from the command line: "+
+				"Count 1 is out of range starting at %d.",
+			math.MaxInt,
+		),
+	)
+}
+
+func (s *CommandLineSuite) TestCounterRereads(c *C) {
+	dest := &struct {
+		Verbosity int `conflag:"short=v,counter,default=1"`
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.Args([]string{"-vv"})
+
+	for i := 0; i < 2; i++ {
+		_, err = config.Read()
+		c.Assert(err, IsNil)
+		c.Assert(dest.Verbosity, Equals, 3)
+	}
+}
+
+func (s *CommandLineSuite) TestCounterRequiresInteger(c *C) {
+	dest := &struct {
+		Verbose bool
+		Retries *int
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	for _, name := range []string{"Verbose", "Retries"} {
+		c.Assert(
+			config.Field(name).Counter,
+			PanicMatches,
+			"conflag: Only integer fields may be counters.",
+		)
+	}
+}
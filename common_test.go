@@ -33,7 +33,10 @@
 package conflag
 
 import (
+	"errors"
 	"io"
+	"strconv"
+	"strings"
 )
 
 // Structs useful for multiple test files
@@ -64,3 +67,64 @@ type testConfig struct {
 		StringField  string
 	}
 }
+
+// A string-backed type that decodes itself as text
+type testLevel string
+
+func (l *testLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug", "info", "error":
+		*l = testLevel(text)
+		return nil
+	}
+	return errors.New("unknown level")
+}
+
+// A struct type implementing flag.Value, which would otherwise be
+// treated as a nested section
+type testPair struct {
+	A, B string
+}
+
+func (p *testPair) String() string {
+	return p.A + "/" + p.B
+}
+
+func (p *testPair) Set(value string) error {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return errors.New("expected a/b")
+	}
+	p.A, p.B = parts[0], parts[1]
+	return nil
+}
+
+// A flag.Value that acts as a boolean flag
+type testSwitch struct {
+	on bool
+}
+
+func (s *testSwitch) String() string {
+	return strconv.FormatBool(s.on)
+}
+
+func (s *testSwitch) Set(value string) error {
+	on, err := strconv.ParseBool(value)
+	s.on = on
+	return err
+}
+
+func (s *testSwitch) IsBoolFlag() bool {
+	return true
+}
+
+// Option blocks shared between several configuration structs
+type testCommonOptions struct {
+	Verbose bool
+	LogFile string
+}
+
+type testDBConfig struct {
+	Host string
+	Port int
+}
@@ -36,13 +36,59 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
-func readConfigFile(dest map[string]*Field, src io.Reader) error {
-	fields := buildConfigFileIndex(dest)
-	scanner := bufio.NewScanner(src)
+const configFileSource = "config file"
+
+// Keys that read another config file in place of the line, unless a
+// field or map section claims them
+const includeKey = "include"
+const optionalIncludeKey = "include_optional"
+
+// Reads a config file, along with any it includes, setting every value
+// found as if from the same source
+type configFileReader struct {
+	source      string
+	fields      map[string]*Field
+	mapSections map[string]*Field
+}
 
+func readConfigFile(
+	dest map[string]*Field,
+	src io.Reader,
+	source string,
+) error {
+	reader := &configFileReader{
+		source:      source,
+		fields:      buildConfigFileIndex(dest),
+		mapSections: buildMapSectionIndex(dest),
+	}
+
+	// Files opened by name can include others relative to themselves
+	name := ""
+	if file, ok := src.(*os.File); ok {
+		name = file.Name()
+	}
+	err := reader.read(src, name, nil)
+	if closer, ok := src.(io.Closer); ok {
+		closer.Close()
+	}
+	return err
+}
+
+// Reads a single file, given the names of the files that included it
+// from the outermost in
+func (r *configFileReader) read(
+	src io.Reader,
+	name string,
+	includedFrom []string,
+) error {
+	chain := append(includedFrom[:len(includedFrom):len(includedFrom)], name)
+
+	scanner := bufio.NewScanner(src)
 	category := ""
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -57,30 +103,129 @@ func readConfigFile(dest map[string]*Field, src io.Reader) error {
 
 		parts := strings.SplitN(line, "=", 2)
 		if len(parts) != 2 {
-			return fmt.Errorf("Invalid configuration line: %s", line)
+			return r.fail(
+				fmt.Errorf("Invalid configuration line: %s", line),
+				chain,
+			)
 		}
 		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		if field, ok := r.mapSections[category]; ok {
+			field.setMapEntry(r.source, key, value)
+			continue
+		}
+		fullKey := key
 		if category != "" {
-			key = category + "." + key
+			fullKey = category + "." + key
 		}
-		value := strings.TrimSpace(parts[1])
 
-		if _, ok := fields[key]; !ok {
-			return fmt.Errorf("Invalid configuration file key: %s", key)
+		// Fields with the same name as a directive take its place
+		field, ok := r.fields[fullKey]
+		if !ok && (key == includeKey || key == optionalIncludeKey) {
+			err := r.include(value, key == optionalIncludeKey, chain)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if !ok {
+			return r.fail(
+				fmt.Errorf("Invalid configuration file key: %s", fullKey),
+				chain,
+			)
 		}
-		field := fields[key]
-		field.parsedValue = value
-		field.found = true
+		field.setValue(r.source, value)
 	}
 	if scanner.Err() != nil {
-		return scanner.Err()
+		return r.fail(scanner.Err(), chain)
 	}
-	if closer, ok := src.(io.Closer); ok {
-		closer.Close()
+	return nil
+}
+
+// Reads the files named by an include line, relative to the including
+// file, given the chain of files that led to it from the outermost in.
+// Optional includes are glob patterns, which may match nothing.
+func (r *configFileReader) include(
+	pattern string,
+	optional bool,
+	chain []string,
+) error {
+	name := chain[len(chain)-1]
+	if !filepath.IsAbs(pattern) && name != "" {
+		pattern = filepath.Join(filepath.Dir(name), pattern)
+	}
+	paths := []string{pattern}
+	if optional {
+		var err error
+		paths, err = filepath.Glob(pattern)
+		if err != nil {
+			return r.fail(
+				fmt.Errorf("Invalid include pattern %s", pattern),
+				chain,
+			)
+		}
+	}
+
+	for _, path := range paths {
+		for _, including := range chain {
+			if sameFile(path, including) {
+				return r.fail(
+					fmt.Errorf("Include cycle through %s", path),
+					chain,
+				)
+			}
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return r.fail(
+				fmt.Errorf("Couldn't open included file: %s", err),
+				chain,
+			)
+		}
+		err = r.read(file, path, chain)
+		file.Close()
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// Notes the file an error was found in, along with the chain of
+// includes that led to it
+func (r *configFileReader) fail(err error, chain []string) error {
+	return fmt.Errorf("conflag: %s (in %s).", err, r.describeChain(chain))
+}
+
+// Describes a chain of includes, from the innermost file out
+func (r *configFileReader) describeChain(chain []string) string {
+	names := []string{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		names = append(names, r.displayName(chain[i]))
+	}
+	return strings.Join(names, ", included from ")
+}
+
+// Names a file in the include chain, where the outermost file may
+// have been given as a reader without a name
+func (r *configFileReader) displayName(name string) string {
+	if name == "" {
+		return r.source
+	}
+	return name
+}
+
+// Compares file paths after making them absolute
+func sameFile(a string, b string) bool {
+	if b == "" {
+		return false
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
 // Get fields indexed by their file category and key instead of config struct
 func buildConfigFileIndex(
 	fields map[string]*Field,
@@ -96,3 +241,20 @@ func buildConfigFileIndex(
 	}
 	return index
 }
+
+// Get map fields indexed by the config file section holding their
+// entries, which is named after their file category and key
+func buildMapSectionIndex(
+	fields map[string]*Field,
+) map[string]*Field {
+	index := map[string]*Field{}
+	for _, v := range fields {
+		if key := v.fileKey; key != "" && v.kind == mapFieldType {
+			if v.fileCategory != "" {
+				key = v.fileCategory + "." + key
+			}
+			index[key] = v
+		}
+	}
+	return index
+}
@@ -34,6 +34,9 @@ package conflag
 
 import (
 	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -71,7 +74,7 @@ func (s *ConfigFileSuite) TestSuccessfulRead(c *C) {
 		bool_key = false`
 
 	reader := strings.NewReader(file)
-	err := readConfigFile(s.fields, reader)
+	err := readConfigFile(s.fields, reader, configFileSource)
 	c.Assert(err, IsNil)
 
 	c.Assert(s.fields["UintField"].found, Equals, true)
@@ -94,9 +97,13 @@ func (s *ConfigFileSuite) TestInvalidConfigLineFails(c *C) {
 `
 
 	reader := strings.NewReader(file)
-	err := readConfigFile(s.fields, reader)
+	err := readConfigFile(s.fields, reader, configFileSource)
 	c.Assert(err, NotNil)
-	c.Assert(err.Error(), Equals, "Invalid configuration line: uint_field 50")
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Invalid configuration line: uint_field 50 (in config file).",
+	)
 }
 
 func (s *ConfigFileSuite) TestInvalidKeyFails(c *C) {
@@ -106,7 +113,172 @@ func (s *ConfigFileSuite) TestInvalidKeyFails(c *C) {
 `
 
 	reader := strings.NewReader(file)
-	err := readConfigFile(s.fields, reader)
+	err := readConfigFile(s.fields, reader, configFileSource)
 	c.Assert(err, NotNil)
-	c.Assert(err.Error(), Equals, "Invalid configuration file key: uint_fied")
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Invalid configuration file key: uint_fied (in config file).",
+	)
+}
+
+func (s *ConfigFileSuite) TestRepeatedSliceKeys(c *C) {
+	dest := &struct{ Peers []string }{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+
+	file := `
+		peers = a
+		peers = b`
+	err = readConfigFile(config.fields, strings.NewReader(file), configFileSource)
+	c.Assert(err, IsNil)
+	c.Assert(config.fields["Peers"].parsedValues, DeepEquals, []string{"a", "b"})
+}
+
+func (s *ConfigFileSuite) TestMapSection(c *C) {
+	dest := &struct {
+		Name   string
+		Labels map[string]string
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+
+	file := `
+		labels = inline=yes
+
+		[labels]
+		env = prod
+		accept = text/html, application/json`
+	err = readConfigFile(config.fields, strings.NewReader(file), configFileSource)
+	c.Assert(err, IsNil)
+	c.Assert(
+		config.fields["Labels"].parsedValues,
+		DeepEquals,
+		[]string{
+			"inline=yes",
+			`"env=prod"`,
+			`"accept=text/html, application/json"`,
+		},
+	)
+}
+
+func (s *ConfigFileSuite) TestIncludes(c *C) {
+	dir := c.MkDir()
+	writeTestFiles(
+		c,
+		dir,
+		map[string]string{
+			"main.conf": "uint_field = 1\ninclude = common/base.conf\n" +
+				"string_field = main\n[struct_field]\n" +
+				"include_optional = extra/*.conf\nbool_field = true",
+			"common/base.conf": "string_field = base\nint_field = 2\n" +
+				"include = nested.conf",
+			"common/nested.conf": "uint_field = 3",
+			"extra/b.conf":       "float_32_field = 0.5",
+			"extra/a.conf":       "float_32_field = 0.25\nfloat_64_field = 1",
+		},
+	)
+
+	file, err := os.Open(filepath.Join(dir, "main.conf"))
+	c.Assert(err, IsNil)
+	err = readConfigFile(s.fields, file, configFileSource)
+	c.Assert(err, IsNil)
+	c.Assert(s.fields["UintField"].parsedValue, Equals, "3")
+	c.Assert(s.fields["IntField"].parsedValue, Equals, "2")
+	c.Assert(s.fields["StringField"].parsedValue, Equals, "main")
+	c.Assert(s.fields["Float32Field"].parsedValue, Equals, "0.5")
+	c.Assert(s.fields["Float64Field"].parsedValue, Equals, "1")
+	c.Assert(s.fields["StructField.BoolField"].parsedValue, Equals, "true")
+	c.Assert(s.fields["UintField"].source, Equals, configFileSource)
+}
+
+func (s *ConfigFileSuite) TestIncludeKeysOwnedByFields(c *C) {
+	dest := &struct {
+		Include string
+		Server  struct {
+			IncludeOptional bool
+		}
+		Headers map[string]string
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+
+	file := `
+		include = a.conf
+
+		[server]
+		include_optional = true
+
+		[headers]
+		include = b.conf`
+	err = readConfigFile(config.fields, strings.NewReader(file), configFileSource)
+	c.Assert(err, IsNil)
+	c.Assert(config.fields["Include"].parsedValue, Equals, "a.conf")
+	c.Assert(
+		config.fields["Server.IncludeOptional"].parsedValue,
+		Equals,
+		"true",
+	)
+	c.Assert(
+		config.fields["Headers"].parsedValues,
+		DeepEquals,
+		[]string{`"include=b.conf"`},
+	)
+}
+
+func (s *ConfigFileSuite) TestIncludeFailures(c *C) {
+	dir := c.MkDir()
+	writeTestFiles(
+		c,
+		dir,
+		map[string]string{
+			"cycle.conf":       "include = sub/loop.conf",
+			"sub/loop.conf":    "include = ../cycle.conf",
+			"self.conf":        "include = self.conf",
+			"missing.conf":     "include_optional = none/*.conf\ninclude = none.conf",
+			"bad.conf":         "include = sub/bad_key.conf",
+			"sub/bad_key.conf": "uint_fied = 50",
+		},
+	)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	for name, message := range map[string]string{
+		"cycle.conf": "conflag: Include cycle through " + path("cycle.conf") +
+			" (in " + path("sub/loop.conf") + ", included from " +
+			path("cycle.conf") + ").",
+		"self.conf": "conflag: Include cycle through " + path("self.conf") +
+			" (in " + path("self.conf") + ").",
+		"missing.conf": "conflag: Couldn't open included file: open " +
+			path("none.conf") + ": no such file or directory (in " +
+			path("missing.conf") + ").",
+		"bad.conf": "conflag: Invalid configuration file key: uint_fied (in " +
+			path("sub/bad_key.conf") + ", included from " +
+			path("bad.conf") + ").",
+		"sub/bad_key.conf": "conflag: Invalid configuration file key: " +
+			"uint_fied (in " + path("sub/bad_key.conf") + ").",
+	} {
+		file, err := os.Open(path(name))
+		c.Assert(err, IsNil)
+		err = readConfigFile(s.fields, file, configFileSource)
+		c.Assert(err, NotNil, Commentf("file %s", name))
+		c.Assert(err.Error(), Equals, message)
+	}
+
+	reader := strings.NewReader("include = missing.conf")
+	err := readConfigFile(s.fields, reader, configFileSource)
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Couldn't open included file: open missing.conf: no such "+
+			"file or directory (in config file).",
+	)
+}
+
+func writeTestFiles(c *C, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		c.Assert(os.MkdirAll(filepath.Dir(path), 0777), IsNil)
+		c.Assert(ioutil.WriteFile(path, []byte(contents), 0666), IsNil)
+	}
 }
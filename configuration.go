@@ -37,7 +37,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 )
 
 // Config stores metadata about your configuration.  You can create
@@ -47,35 +49,80 @@ type Config struct {
 	name             string
 	description      string
 	destination      reflect.Value
+	decoders         decoderRegistry
 	fields           map[string]*Field
 	fieldKeysInOrder []string
-	fileName         string
-	file             io.Reader
+	files            []configFile
+	searchFallbacks  []string
+	fileFormat       FileFormat
 	fileShortFlag    rune
 	fileLongFlag     string
 	fileRequired     bool
+	envPrefix        string
+	envPrefixSet     bool
+	env              []string
 	args             []string
 	extraArgsAllowed bool
 }
 
 // New creates a new Config based on a destination struct.  The
-// destination parameter must be a pointer to a struct containing
-// fields of the allowed types (bool, int*, uint*, float*, and
-// string).  Top-level fields may also be anonymous structs containing
-// fields of the allowed types, but these can only go a single level
-// deep.  By default nested structs as fields will represent sections
-// of a config file.
+// destination parameter must be a pointer to a struct containing fields
+// of the allowed types: bool (true/false, yes/no, on/off or 1/0), int*,
+// uint*, float*, string, time.Duration (which also accepts days and
+// weeks, e.g. "1d12h"), time.Time, *time.Location, net.IP, the netip
+// address types, *url.URL (absolute URLs only), HostPort, ByteSize, any
+// type whose pointer implements encoding.TextUnmarshaler or flag.Value,
+// and any type with a decoder registered by RegisterDecoder.  Fields
+// may also be pointers to these, which are left nil unless a value is
+// found for them, or slices, arrays or maps of them, as described under
+// Field.Separator.  Fields may also be structs containing fields of the
+// allowed types, nested to any depth.  By default nested structs as
+// fields will represent sections of a config file, while the fields of
+// embedded structs are promoted into the enclosing struct just as they
+// are in Go.  Promoted fields must not share a name with any other
+// field in the enclosing struct.  Unexported fields and fields tagged
+// with `conflag:"-"` are skipped, and may be of any type.
 //
 // For each field, New will set a default file category, file key, and
 // long command-line flag.  Both are formed by converting the field
 // names from the destination struct into lower-camel-case,
 // e.g. "ExampleField" becomes "example_field".  The file key as
 // always the field name in lower-camel-case.  The file category will
-// be the name of the enclosing anonymous struct field in the same
-// style, if it exists.  The long-form command-line flag will be the
-// same as the file key for top-level fields, and for nested fields it
-// will be of the form category_name.field_name.
+// be the names of the enclosing struct fields in the same style,
+// joined by '.', if there are any, e.g. "database.replica" for a
+// [database.replica] section.  The long-form command-line flag will be
+// the same as the file key with '_' replaced by '-' for top-level
+// fields, and for nested fields it will be of the form
+// category-name.field-name, e.g. --database.replica.host-name.
+//
+// These settings may be changed with a conflag struct tag on each
+// field, a comma-separated list of options each matching one of the
+// Field modifier methods: long, short, inverse (InverseLongFlag),
+// inverse-short, category, key, env, desc, required, counter, default,
+// sep, choices (separated by '|'), units (si, bytes or percent) and
+// layout (TimeLayout).  For example:
+//
+//	Port int `conflag:"short=p,desc='Port to serve on, by number',default=80"`
+//
+// Values containing commas are wrapped in single quotes.  Options may
+// be given in any order: counter is always applied before the inverse
+// flags that need it, and default after the choices, units and layout
+// that it's checked against.  Tags are applied by New, so calling the
+// modifier methods afterwards overrides them, and New returns an error
+// for any malformed tag.
 func New(destination interface{}) (*Config, error) {
+	return NewWithDecoders(destination, nil)
+}
+
+// NewWithDecoders creates a new Config in the same way as New, but
+// with additional decoders used only by this Config.  These take
+// precedence over decoders registered with RegisterDecoder and over
+// conflag's built-in handling of each type, and allow fields of
+// types that couldn't otherwise be used.
+func NewWithDecoders(
+	destination interface{},
+	decoders map[reflect.Type]DecodeFunc,
+) (*Config, error) {
 	destValue := reflect.ValueOf(destination)
 
 	if destValue.Type().Kind() != reflect.Ptr {
@@ -94,24 +141,33 @@ func New(destination interface{}) (*Config, error) {
 		name:             "",
 		description:      "",
 		destination:      destValue,
+		decoders:         decoderRegistry{},
 		fields:           map[string]*Field{},
 		fieldKeysInOrder: []string{},
-		fileName:         "",
-		file:             nil,
+		files:            []configFile{},
+		searchFallbacks:  []string{},
+		fileFormat:       INIFormat,
 		fileShortFlag:    0,
 		fileLongFlag:     "",
 		fileRequired:     false,
+		envPrefix:        "",
+		envPrefixSet:     false,
+		env:              os.Environ(),
 		args:             os.Args[1:],
 		extraArgsAllowed: false,
 	}
+	for t, decode := range decoders {
+		config.decoders[t] = decoder{customFieldType, decode}
+	}
 	for i := 0; i < destValue.NumField(); i++ {
 		field := destValue.FieldByIndex([]int{i})
 		err := processField(
 			config.fields,
 			&config.fieldKeysInOrder,
+			config.decoders,
 			field,
 			"",
-			destValue.Type().Field(i).Name,
+			destValue.Type().Field(i),
 		)
 		if err != nil {
 			return nil, err
@@ -136,8 +192,9 @@ func (c *Config) ProgramDescription(description string) *Config {
 
 // Field retrieves an individual field from the configuration for you
 // to modify.  It expects a field name matching an exported field in
-// the destination configuration struct.  To access a subfield of an
-// anonymous struct field, use "OuterField.InnerField".  Returns nil
+// the destination configuration struct.  To access a subfield of a
+// nested struct field, use the full path to it separated by '.',
+// e.g. "OuterField.InnerField" or "Database.Replica.Host".  Panics
 // for an invalid field name.
 func (c *Config) Field(field string) *Field {
 	if val, ok := c.fields[field]; ok {
@@ -151,61 +208,183 @@ func (c *Config) Field(field string) *Field {
 	)
 }
 
-// ConfigReader sets an open io.Reader to read settings directly from.
-// If the value also implements io.Closer, it will be closed after
-// reading.  If you intend to simply open a file on disk, consider
-// using the convenience function ConfigFile.
-func (c *Config) ConfigReader(file io.Reader) *Config {
-	if c.file != nil || c.fileName != "" {
+// Ignore removes a field from the configuration, so that it's left
+// untouched by Read and doesn't appear in the usage text.  It accepts
+// the same field names as Field, and given the name of a nested
+// struct field it removes every field within it.  Fields of types
+// conflag can't read make New fail before Ignore can be called, so
+// they must be excluded with a `conflag:"-"` struct tag instead.
+// Unexported fields are always ignored.
+func (c *Config) Ignore(field string) *Config {
+	remainingKeys := []string{}
+	for _, key := range c.fieldKeysInOrder {
+		if key == field || strings.HasPrefix(key, field+".") {
+			delete(c.fields, key)
+		} else {
+			remainingKeys = append(remainingKeys, key)
+		}
+	}
+	if len(remainingKeys) == len(c.fieldKeysInOrder) {
 		panic(
-			errors.New("You have already set a config file for this config."),
+			fmt.Errorf(
+				"Field %s isn't present in your configuration struct.",
+				field,
+			),
 		)
 	}
-	c.file = file
+	c.fieldKeysInOrder = remainingKeys
 	return c
 }
 
-// ConfigFile sets a file path to read a config file from.  If the
-// file is not present or otherwise unopenable, it will simply be
-// ignored.
+// ConfigReader adds an open io.Reader to the list of config files to
+// read settings from.  If the value also implements io.Closer, it will
+// be closed after reading.  If you intend to simply open a file on
+// disk, consider using the convenience function ConfigFile.
+func (c *Config) ConfigReader(file io.Reader) *Config {
+	c.files = append(c.files, configFile{reader: file})
+	return c
+}
+
+// ConfigFile adds a file path to the list of config files to read
+// settings from.  Config files are read in the order they're added,
+// and values in later files override those in earlier ones, e.g.
+// /etc/app.conf, then ~/.config/app.conf, then ./app.conf.  If the file
+// doesn't exist, it will simply be skipped.
+//
+// A config file may read others in place with an include line, e.g.
+// "include = common.conf", which must name an existing file, or
+// "include_optional = conf.d/*.conf", a glob pattern which may match
+// nothing.  Relative paths are resolved against the directory of the
+// including file, and each included file starts outside of any
+// section.  Lines in a map field's section, or with a key belonging to
+// a field, are always read as values instead.
 func (c *Config) ConfigFile(fileName string) *Config {
-	if c.file != nil || c.fileName != "" {
+	c.files = append(c.files, configFile{name: fileName})
+	return c
+}
+
+// RequiredConfigFile adds a file path to the list of config files in
+// the same way as ConfigFile, but Read will return an error if the
+// file doesn't exist.
+func (c *Config) RequiredConfigFile(fileName string) *Config {
+	c.files = append(c.files, configFile{name: fileName, required: true})
+	return c
+}
+
+// SearchConfigFile adds the first config file found at a relative
+// path, e.g. "myapp/config.ini", to the list of config files.  It's
+// searched for following the XDG Base Directory Specification, first
+// in $XDG_CONFIG_HOME (by default ~/.config) and then in each of
+// $XDG_CONFIG_DIRS (by default /etc/xdg), and finally as the base name
+// of the path in each directory set by ConfigSearchFallbacks.  If the
+// file isn't found anywhere it will simply be skipped.  The places
+// searched are listed in the usage text.
+func (c *Config) SearchConfigFile(path string) *Config {
+	c.files = append(c.files, configFile{search: path})
+	return c
+}
+
+// SearchConfigFiles searches for a config file in the same places as
+// SearchConfigFile, but adds every file found to the list of config
+// files rather than only the first.  They're read from the least to
+// the most important, so that e.g. ~/.config/myapp/config.ini
+// overrides /etc/xdg/myapp/config.ini.
+func (c *Config) SearchConfigFiles(path string) *Config {
+	c.files = append(c.files, configFile{search: path, searchAll: true})
+	return c
+}
+
+// ConfigSearchFallbacks sets directories to search for config files
+// in after the XDG ones, from the most to the least important, e.g.
+// /etc/myapp to find /etc/myapp/config.ini for SearchConfigFile with
+// "myapp/config.ini".
+func (c *Config) ConfigSearchFallbacks(dirs ...string) *Config {
+	c.searchFallbacks = dirs
+	return c
+}
+
+// ConfigDir adds every file in a directory matching a pattern, in the
+// form accepted by filepath.Match, to the list of config files, e.g.
+// "/etc/myapp/conf.d" with "*.conf".  The files are read in lexical
+// order, so fragments are commonly named with a numeric prefix such as
+// 10-network.conf.  If the directory doesn't exist it will simply be
+// skipped.  Directories are read after every other config file,
+// whatever order they're added in, so that their fragments merge over
+// the main config file, and unlike other config files they're still
+// read after any config files set on the command line.  Panics for an
+// invalid pattern.
+func (c *Config) ConfigDir(path string, pattern string) *Config {
+	if _, err := filepath.Match(pattern, ""); err != nil {
 		panic(
-			errors.New("You have already set a config file for this config."),
+			fmt.Errorf("conflag: Invalid config file pattern %s.", pattern),
 		)
 	}
-	c.fileName = fileName
+	c.files = append(c.files, configFile{dir: path, pattern: pattern})
+	return c
+}
+
+// ConfigFormat sets the format of config files given by ConfigReader,
+// and of files whose extension doesn't name a format.  Files ending in
+// .json are always read as JSON, in .toml as TOML, in .yaml or .yml as
+// YAML, and in .ini as INI.
+func (c *Config) ConfigFormat(format FileFormat) *Config {
+	c.fileFormat = format
 	return c
 }
 
 // ConfigFileShortFlag sets a short command-line flag with which the
-// user can specify a config file.  If this option is set and the user
-// sets a config file, it will take precedence over a file specified
-// with the ConfigReader or ConfigFile options.
+// user can specify a config file.  The flag may be repeated to read
+// several files in order, e.g. -c a.conf -c b.conf.  If this option is
+// set and the user sets a config file, it will take precedence over
+// any files specified with the ConfigReader or ConfigFile options.
 func (c *Config) ConfigFileShortFlag(flag rune) *Config {
 	c.fileShortFlag = flag
 	return c
 }
 
 // ConfigFileLongFlag sets a long command-line flag with which the
-// user can specify a config file.  If this option is set and the user
-// sets a config file, it will take precedence over a file specified
-// with the ConfigReader or ConfigFile options.
+// user can specify a config file.  The flag may be repeated to read
+// several files in order.  If this option is set and the user sets a
+// config file, it will take precedence over any files specified with
+// the ConfigReader or ConfigFile options.
 func (c *Config) ConfigFileLongFlag(flag string) *Config {
 	c.fileLongFlag = flag
 	return c
 }
 
-// ConfigFileRequired requires that a config file path is set (by
-// calling ConfigFile or ConfigReader, or by command line argument
-// with ConfigFileShortFlag or ConfigFileLongFlag) and the file
-// exists.  If the file can't be opened, subsequent calls to Parse
-// will return an error.
+// ConfigFileRequired requires that at least one config file is read,
+// whether set by calling ConfigFile, RequiredConfigFile or
+// ConfigReader, or by command line argument with ConfigFileShortFlag
+// or ConfigFileLongFlag.  If no config file can be opened, subsequent
+// calls to Parse will return an error.
 func (c *Config) ConfigFileRequired() *Config {
 	c.fileRequired = true
 	return c
 }
 
+// EnvPrefix reads every field from an environment variable named
+// after the prefix and the field's file category and key, converted to
+// upper case and joined by '_', e.g. MYAPP_DATABASE_HOST for the key
+// host in the database category with prefix MYAPP.  An empty prefix
+// leaves the names unprefixed.  Fields without a file key, and fields
+// given their own name with Field.EnvVar, are unaffected.  Environment
+// variables take precedence over the config file, and command-line
+// flags over both.
+func (c *Config) EnvPrefix(prefix string) *Config {
+	c.envPrefix = prefix
+	c.envPrefixSet = true
+	return c
+}
+
+// Environment sets the environment variables to read settings from,
+// each in the form key=value as returned by os.Environ.  If you don't
+// explicitly set the environment, os.Environ will be used as the
+// default.
+func (c *Config) Environment(env []string) *Config {
+	c.env = env
+	return c
+}
+
 // Args sets a slice of command-line arguments to parse settings from.
 // If you don't explicitly set the command-line arguments, os.Args
 // will be used as the default.
@@ -59,9 +59,8 @@ func (s *ConfigSuite) TestConfigFileReader(c *C) {
 	reader := strings.NewReader("config string")
 	config.ConfigReader(reader)
 
-	c.Assert(config.fileName, Equals, "")
+	c.Assert(config.files, DeepEquals, []configFile{{reader: reader}})
 	c.Assert(config.fileRequired, Equals, false)
-	c.Assert(config.file, NotNil)
 }
 
 func (s *ConfigSuite) TestConfigFileName(c *C) {
@@ -71,9 +70,8 @@ func (s *ConfigSuite) TestConfigFileName(c *C) {
 
 	config.ConfigFile("/file/name")
 
-	c.Assert(config.fileName, Equals, "/file/name")
+	c.Assert(config.files, DeepEquals, []configFile{{name: "/file/name"}})
 	c.Assert(config.fileRequired, Equals, false)
-	c.Assert(config.file, IsNil)
 }
 
 func (s *ConfigSuite) TestConfigFileRequired(c *C) {
@@ -83,23 +81,29 @@ func (s *ConfigSuite) TestConfigFileRequired(c *C) {
 
 	config.ConfigFileRequired()
 
-	c.Assert(config.fileName, Equals, "")
+	c.Assert(config.files, HasLen, 0)
 	c.Assert(config.fileRequired, Equals, true)
-	c.Assert(config.file, IsNil)
 }
 
-func (s *ConfigSuite) TestMultipleConfigFilesFailure(c *C) {
-	defer func() {
-		c.Assert(recover(), NotNil)
-	}()
-
+func (s *ConfigSuite) TestMultipleConfigFiles(c *C) {
 	config, err := New(&s.dest)
 	c.Assert(err, IsNil)
 	c.Assert(config, NotNil)
 
 	reader := strings.NewReader("config file")
+	config.ConfigFile("/etc/app.conf")
 	config.ConfigReader(reader)
-	config.ConfigFile("/file/name")
+	config.RequiredConfigFile("/file/name")
+
+	c.Assert(
+		config.files,
+		DeepEquals,
+		[]configFile{
+			{name: "/etc/app.conf"},
+			{reader: reader},
+			{name: "/file/name", required: true},
+		},
+	)
 }
 
 func (s *ConfigSuite) TestArgs(c *C) {
@@ -113,3 +117,38 @@ func (s *ConfigSuite) TestArgs(c *C) {
 	c.Assert(len(config.args), Equals, 3)
 	c.Assert(config.args, DeepEquals, []string{"slice", "of", "args"})
 }
+
+func (s *ConfigSuite) TestIgnore(c *C) {
+	config, err := New(&s.dest)
+	c.Assert(err, IsNil)
+	c.Assert(config, NotNil)
+
+	config.Ignore("IntField").Ignore("StructField")
+	c.Assert(
+		config.fieldKeysInOrder,
+		DeepEquals,
+		[]string{
+			"BoolField",
+			"UintField",
+			"Float32Field",
+			"Float64Field",
+			"StringField",
+		},
+	)
+	c.Assert(len(config.fields), Equals, 5)
+
+	_, err = config.Args([]string{"--int-field", "5"}).Read()
+	c.Assert(err, NotNil)
+}
+
+func (s *ConfigSuite) TestIgnoreMissingFieldFailure(c *C) {
+	defer func() {
+		c.Assert(recover(), NotNil)
+	}()
+
+	config, err := New(&s.dest)
+	c.Assert(err, IsNil)
+	c.Assert(config, NotNil)
+
+	config.Ignore("Struct")
+}
@@ -0,0 +1,295 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// DecodeFunc converts a raw configuration value, as read from a config
+// file or the command line, into a value of the type it was
+// registered for.
+type DecodeFunc func(value string) (interface{}, error)
+
+type decoder struct {
+	kind fieldType
+	// Left nil for flag.Value types, which are set in place
+	decode DecodeFunc
+}
+
+type decoderRegistry map[reflect.Type]decoder
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+var flagValueType = reflect.TypeOf((*flag.Value)(nil)).Elem()
+
+// The predeclared type for each kind that can be decoded by
+// converting from it
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:    reflect.TypeOf(false),
+	reflect.Int:     reflect.TypeOf(int(0)),
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint:    reflect.TypeOf(uint(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+	reflect.String:  reflect.TypeOf(""),
+}
+
+// Names used in error messages for values that fail to decode as one
+// of the built-in field types
+var fieldTypeNames = map[fieldType]string{
+	intFieldType:      "integer",
+	uintFieldType:     "unsigned integer",
+	floatFieldType:    "floating point number",
+	durationFieldType: "duration",
+}
+
+var defaultDecoders = decoderRegistry{}
+
+func init() {
+	for kind, t := range basicTypes {
+		switch kind {
+		case reflect.Bool:
+			defaultDecoders[t] = decoder{boolFieldType, decodeBool}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+			reflect.Int64:
+			defaultDecoders[t] = decoder{intFieldType, decodeInt}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+			reflect.Uint64:
+			defaultDecoders[t] = decoder{uintFieldType, decodeUint}
+		case reflect.Float32, reflect.Float64:
+			defaultDecoders[t] = decoder{floatFieldType, decodeFloat}
+		case reflect.String:
+			defaultDecoders[t] = decoder{stringFieldType, decodeString}
+		}
+	}
+	defaultDecoders[durationType] = decoder{durationFieldType, decodeDuration}
+}
+
+// RegisterDecoder sets the function used by every Config to decode
+// values of the given type, taking precedence over conflag's built-in
+// handling of the type.  The function must return a value assignable
+// or convertible to the type.  Registration is not safe for
+// concurrent use, and should happen before any Config is created,
+// e.g. in an init function.
+func RegisterDecoder(t reflect.Type, decode DecodeFunc) {
+	defaultDecoders[t] = decoder{customFieldType, decode}
+}
+
+// Finds the decoder for a type, checking the registry itself before
+// the package defaults.  Registered types take precedence over types
+// implementing encoding.TextUnmarshaler or flag.Value, which in turn
+// take precedence over the decoder for the type's kind.
+func (r decoderRegistry) lookup(t reflect.Type) (decoder, bool) {
+	if d, ok := r[t]; ok {
+		return d, true
+	}
+	if d, ok := defaultDecoders[t]; ok {
+		return d, true
+	}
+
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return decoder{textFieldType, textDecoder(t)}, true
+	}
+	if reflect.PtrTo(t).Implements(flagValueType) {
+		return decoder{flagValueFieldType, nil}, true
+	}
+
+	if basicType, ok := basicTypes[t.Kind()]; ok {
+		if d, ok := r[basicType]; ok {
+			return d, true
+		}
+		if d, ok := defaultDecoders[basicType]; ok {
+			return d, true
+		}
+	}
+	return decoder{}, false
+}
+
+// Finds the field type for a reflect.Type, or invalidFieldType if it
+// can't be decoded
+func (r decoderRegistry) fieldType(t reflect.Type) fieldType {
+	d, ok := r.lookup(t)
+	if !ok {
+		return invalidFieldType
+	}
+	return d.kind
+}
+
+// Decodes a single raw value and stores it in dest
+func (r decoderRegistry) decode(dest reflect.Value, value string) error {
+	d, ok := r.lookup(dest.Type())
+	if !ok {
+		return fmt.Errorf("No decoder for type %s", dest.Type())
+	}
+
+	if d.kind == flagValueFieldType {
+		// Set is called on the destination itself, so that values
+		// that accumulate or depend on their existing state behave as
+		// they do with the flag package
+		err := dest.Addr().Interface().(flag.Value).Set(value)
+		if err != nil {
+			return fmt.Errorf("Couldn't parse %s: %s", value, err)
+		}
+		return nil
+	}
+
+	result, err := d.decode(value)
+	if err != nil {
+		if name, ok := fieldTypeNames[d.kind]; ok {
+			return fmt.Errorf("Couldn't parse %s as %s", value, name)
+		}
+		return fmt.Errorf("Couldn't parse %s: %s", value, err)
+	}
+
+	resultValue := reflect.ValueOf(result)
+	if !resultValue.IsValid() ||
+		!resultValue.Type().ConvertibleTo(dest.Type()) {
+		return fmt.Errorf(
+			"Decoder for %s returned %T",
+			dest.Type(),
+			result,
+		)
+	}
+	if overflows(resultValue, dest) {
+		return fmt.Errorf("%s is out of range for %s", value, dest.Type())
+	}
+	dest.Set(resultValue.Convert(dest.Type()))
+	return nil
+}
+
+// Reports whether a decoded number is too large, or for unsigned
+// types negative, to be held by dest.  Numbers are decoded at their
+// full width, and converting them to a narrower type would otherwise
+// silently wrap or truncate them.
+func overflows(value reflect.Value, dest reflect.Value) bool {
+	switch {
+	case isInt(value.Kind()) && isInt(dest.Kind()):
+		return dest.OverflowInt(value.Int())
+	case isInt(value.Kind()) && isUint(dest.Kind()):
+		return value.Int() < 0 || dest.OverflowUint(uint64(value.Int()))
+	case isUint(value.Kind()) && isUint(dest.Kind()):
+		return dest.OverflowUint(value.Uint())
+	case isUint(value.Kind()) && isInt(dest.Kind()):
+		return value.Uint() > math.MaxInt64 ||
+			dest.OverflowInt(int64(value.Uint()))
+	case isFloat(value.Kind()) && isFloat(dest.Kind()):
+		return dest.OverflowFloat(value.Float())
+	}
+	return false
+}
+
+func isInt(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Int64
+}
+
+func isUint(kind reflect.Kind) bool {
+	return kind >= reflect.Uint && kind <= reflect.Uintptr
+}
+
+func isFloat(kind reflect.Kind) bool {
+	return kind == reflect.Float32 || kind == reflect.Float64
+}
+
+// Booleans may be written as true/false, yes/no, on/off or 1/0, in
+// any case.  Anything else is rejected rather than read as false, so
+// that a typo can't silently turn a setting off.
+func decodeBool(value string) (interface{}, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	}
+	return nil, errors.New("expected true, false, yes, no, on, off, 1 or 0")
+}
+
+func decodeInt(value string) (interface{}, error) {
+	return strconv.ParseInt(integerLiteral(value), 0, 64)
+}
+
+func decodeUint(value string) (interface{}, error) {
+	return strconv.ParseUint(integerLiteral(value), 0, 64)
+}
+
+// Prepares an integer for strconv's base 0 parsing, which accepts Go
+// syntax such as 0x1F, 0o755, 0b101 and 1_000_000.  Unlike Go, a
+// leading zero alone doesn't mean octal, so that zero-padded values
+// like 08 are read as decimal.
+func integerLiteral(value string) string {
+	sign := ""
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		sign, value = value[:1], value[1:]
+	}
+	for len(value) > 1 && value[0] == '0' && value[1] >= '0' &&
+		value[1] <= '9' {
+		value = value[1:]
+	}
+	return sign + value
+}
+
+func decodeFloat(value string) (interface{}, error) {
+	return strconv.ParseFloat(value, 64)
+}
+
+func decodeString(value string) (interface{}, error) {
+	return value, nil
+}
+
+func decodeDuration(value string) (interface{}, error) {
+	return parseDuration(value)
+}
+
+func textDecoder(t reflect.Type) DecodeFunc {
+	return func(value string) (interface{}, error) {
+		result := reflect.New(t)
+		unmarshaler := result.Interface().(encoding.TextUnmarshaler)
+		if err := unmarshaler.UnmarshalText([]byte(value)); err != nil {
+			return nil, err
+		}
+		return result.Elem().Interface(), nil
+	}
+}
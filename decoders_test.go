@@ -0,0 +1,327 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"errors"
+	. "gopkg.in/check.v1"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type DecodersSuite struct{}
+
+func TestDecoders(t *testing.T) {
+	Suite(&DecodersSuite{})
+	TestingT(t)
+}
+
+// Stands in for a third-party struct type we can't add methods to
+type testPoint struct {
+	X, Y int
+}
+
+type testPort int
+
+// A flag.Value that adds to its existing contents on every Set
+type testTally struct {
+	items []string
+}
+
+func (t *testTally) String() string {
+	return strings.Join(t.items, ",")
+}
+
+func (t *testTally) Set(value string) error {
+	t.items = append(t.items, value)
+	return nil
+}
+
+func decodeTestPoint(value string) (interface{}, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return nil, errors.New("expected x,y")
+	}
+	x, err := decodeInt(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeInt(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return testPoint{X: int(x.(int64)), Y: int(y.(int64))}, nil
+}
+
+func (s *DecodersSuite) TestBuiltinKinds(c *C) {
+	registry := decoderRegistry{}
+	c.Assert(registry.fieldType(reflect.TypeOf(uint8(0))), Equals, uintFieldType)
+	c.Assert(registry.fieldType(reflect.TypeOf(testPort(0))), Equals, intFieldType)
+	c.Assert(registry.fieldType(durationType), Equals, durationFieldType)
+	c.Assert(registry.fieldType(reflect.TypeOf(testPoint{})), Equals, invalidFieldType)
+
+	var port testPort
+	err := registry.decode(reflect.ValueOf(&port).Elem(), "8080")
+	c.Assert(err, IsNil)
+	c.Assert(port, Equals, testPort(8080))
+}
+
+func (s *DecodersSuite) TestConfigDecoders(c *C) {
+	dest := &struct {
+		Origin  testPoint
+		Corners []testPoint
+		Port    testPort
+	}{}
+	config, err := NewWithDecoders(
+		dest,
+		map[reflect.Type]DecodeFunc{
+			reflect.TypeOf(testPoint{}): decodeTestPoint,
+			reflect.TypeOf(0): func(value string) (interface{}, error) {
+				if value == "http" {
+					return 80, nil
+				}
+				return decodeInt(value)
+			},
+		},
+	)
+	c.Assert(err, IsNil)
+	c.Assert(config.Field("Origin").kind, Equals, customFieldType)
+	c.Assert(config.Field("Port").kind, Equals, customFieldType)
+
+	config.Args(
+		[]string{
+			"--origin", "1,2",
+			"--corners", `"0,0","3,4"`,
+			"--port", "http",
+		},
+	)
+	_, err = config.Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Origin, Equals, testPoint{1, 2})
+	c.Assert(dest.Corners, DeepEquals, []testPoint{{0, 0}, {3, 4}})
+	c.Assert(dest.Port, Equals, testPort(80))
+
+	// Other configs shouldn't see these decoders
+	config, err = New(dest)
+	c.Assert(err, NotNil)
+}
+
+func (s *DecodersSuite) TestRegisterDecoder(c *C) {
+	type registeredPoint testPoint
+	RegisterDecoder(
+		reflect.TypeOf(registeredPoint{}),
+		func(value string) (interface{}, error) {
+			point, err := decodeTestPoint(value)
+			if err != nil {
+				return nil, err
+			}
+			return registeredPoint(point.(testPoint)), nil
+		},
+	)
+	defer delete(defaultDecoders, reflect.TypeOf(registeredPoint{}))
+
+	dest := &struct{ Origin registeredPoint }{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+
+	_, err = config.Args([]string{"--origin", "5,6"}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Origin, Equals, registeredPoint{5, 6})
+
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	_, err = config.Args([]string{"--origin", "5"}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Invalid value for Origin from the command line: "+
+			"Couldn't parse 5: expected x,y.",
+	)
+}
+
+func (s *DecodersSuite) TestWrongResultType(c *C) {
+	registry := decoderRegistry{
+		reflect.TypeOf(""): decoder{
+			customFieldType,
+			func(value string) (interface{}, error) {
+				return []int{}, nil
+			},
+		},
+	}
+	var dest string
+	err := registry.decode(reflect.ValueOf(&dest).Elem(), "value")
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "Decoder for string returned []int")
+}
+
+func (s *DecodersSuite) TestFlagValueSetInPlace(c *C) {
+	dest := &struct{ Tally testTally }{}
+	dest.Tally.items = []string{"base"}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	_, err = config.Args([]string{"--tally", "extra"}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Tally.items, DeepEquals, []string{"base", "extra"})
+}
+
+func (s *DecodersSuite) TestIntegerSyntax(c *C) {
+	registry := decoderRegistry{}
+	cases := map[string]int64{
+		"0x1F":      31,
+		"0o755":     493,
+		"0b101":     5,
+		"1_000_000": 1000000,
+		"0755":      755,
+		"-08":       -8,
+		"0":         0,
+	}
+	for input, expected := range cases {
+		var result int64
+		err := registry.decode(reflect.ValueOf(&result).Elem(), input)
+		c.Assert(err, IsNil, Commentf("input %s", input))
+		c.Assert(result, Equals, expected)
+	}
+
+	var mode uint32
+	err := registry.decode(reflect.ValueOf(&mode).Elem(), "0o644")
+	c.Assert(err, IsNil)
+	c.Assert(mode, Equals, uint32(0644))
+
+	var bad int
+	err = registry.decode(reflect.ValueOf(&bad).Elem(), "1__0")
+	c.Assert(err, NotNil)
+}
+
+func (s *DecodersSuite) TestStrictBools(c *C) {
+	registry := decoderRegistry{}
+	cases := map[string]bool{
+		"true":  true,
+		"Yes":   true,
+		"on":    true,
+		"1":     true,
+		"false": false,
+		"NO":    false,
+		"off":   false,
+		"0":     false,
+	}
+	for input, expected := range cases {
+		result := !expected
+		err := registry.decode(reflect.ValueOf(&result).Elem(), input)
+		c.Assert(err, IsNil, Commentf("input %s", input))
+		c.Assert(result, Equals, expected)
+	}
+
+	dest := &struct{ Enabled bool }{Enabled: true}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.ConfigReader(strings.NewReader("enabled = ture"))
+	_, err = config.Args([]string{}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Invalid value for Enabled from config file: "+
+			"Couldn't parse ture: expected true, false, yes, no, on, off, "+
+			"1 or 0.",
+	)
+	c.Assert(dest.Enabled, Equals, true)
+}
+
+func (s *DecodersSuite) TestNumericRange(c *C) {
+	registry := decoderRegistry{}
+	var small int8
+	var unsigned uint8
+	var single float32
+	c.Assert(registry.decode(reflect.ValueOf(&small).Elem(), "-128"), IsNil)
+	c.Assert(small, Equals, int8(-128))
+	c.Assert(registry.decode(reflect.ValueOf(&unsigned).Elem(), "255"), IsNil)
+	c.Assert(unsigned, Equals, uint8(255))
+	c.Assert(registry.decode(reflect.ValueOf(&single).Elem(), "1e38"), IsNil)
+
+	for _, test := range []struct {
+		dest    interface{}
+		value   string
+		message string
+	}{
+		{&small, "128", "128 is out of range for int8"},
+		{&unsigned, "256", "256 is out of range for uint8"},
+		{&single, "1e39", "1e39 is out of range for float32"},
+	} {
+		err := registry.decode(reflect.ValueOf(test.dest).Elem(), test.value)
+		c.Assert(err, NotNil, Commentf("value %s", test.value))
+		c.Assert(err.Error(), Equals, test.message)
+	}
+
+	// Neither unit suffixes nor custom decoders get around the range
+	// check
+	dest := &struct {
+		Level uint8 `conflag:"units=si"`
+		Port  uint16
+	}{}
+	decoders := map[reflect.Type]DecodeFunc{
+		reflect.TypeOf(uint16(0)): func(value string) (interface{}, error) {
+			return int64(-1), nil
+		},
+	}
+	for args, message := range map[string]string{
+		"--level 1k": "conflag: Invalid value for Level from the command " +
+			"line: 1000 is out of range for uint8 (from 1k).",
+		"--port 80": "conflag: Invalid value for Port from the command " +
+			"line: 80 is out of range for uint16.",
+	} {
+		config, err := NewWithDecoders(dest, decoders)
+		c.Assert(err, IsNil)
+		_, err = config.Args(strings.Fields(args)).Read()
+		c.Assert(err, NotNil, Commentf("args %s", args))
+		c.Assert(err.Error(), Equals, message)
+	}
+
+	// Range and parse errors name the field and where its value came
+	// from
+	rangeDest := &struct{ Small uint8 }{}
+	for env, message := range map[string]string{
+		"X_SMALL=300": "conflag: Invalid value for Small from environment " +
+			"variable X_SMALL: 300 is out of range for uint8.",
+		"X_SMALL=abc": "conflag: Invalid value for Small from environment " +
+			"variable X_SMALL: Couldn't parse abc as unsigned integer.",
+	} {
+		config, err := New(rangeDest)
+		c.Assert(err, IsNil)
+		config.EnvPrefix("X").Environment([]string{env})
+		_, err = config.Args([]string{}).Read()
+		c.Assert(err, NotNil, Commentf("env %s", env))
+		c.Assert(err.Error(), Equals, message)
+	}
+}
@@ -35,8 +35,8 @@
 Package conflag implements simple program configuration parsing.  It
 allows you to create a set of options for your program in a struct
 definition, and then load them from any combination of defaults, a
-configuration file, and command-line flags.  As an example, consider
-the following struct definition:
+configuration file, environment variables, and command-line flags.
+As an example, consider the following struct definition:
 
 	type ServerConfig struct {
 		Port int
@@ -65,5 +65,20 @@ make the path field required and give it a short command-line flag of
 -p:
 
 	configParser.Field("Path").Required().ShortFlag('p')
+
+The same settings can be given declaratively with struct tags, which
+New applies before you make any modifications of your own:
+
+	type ServerConfig struct {
+		Port int
+		Path string `conflag:"short=p,required"`
+	}
+
+To also read settings from environment variables named after the
+config file keys, e.g. SERVER_PORT and SERVER_PATH, set a prefix for
+them.  The environment takes precedence over the config file, and the
+command line over both.
+
+	configParser.EnvPrefix("SERVER")
 */
 package conflag
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+const day = 24 * time.Hour
+
+var longDurationUnits = map[string]time.Duration{
+	"d": day,
+	"w": 7 * day,
+}
+
+var errDurationRange = errors.New("duration out of range")
+
+var longDurationComponent = regexp.MustCompile(`([0-9]*\.?[0-9]+)([dw])`)
+
+// Parses a duration in the syntax accepted by time.ParseDuration,
+// extended with units of days (d) and weeks (w), e.g. "1d12h"
+func parseDuration(value string) (time.Duration, error) {
+	s := strings.TrimSpace(value)
+	sign := ""
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		sign, s = s[:1], s[1:]
+	}
+	if s == "" || strings.ContainsAny(s, "+-") {
+		return 0, errors.New("invalid duration")
+	}
+
+	var long time.Duration
+	var err error
+	rest := longDurationComponent.ReplaceAllStringFunc(
+		s,
+		func(component string) string {
+			unit := component[len(component)-1:]
+			amount, parseErr := strconv.ParseFloat(
+				component[:len(component)-1],
+				64,
+			)
+			if parseErr != nil {
+				err = parseErr
+			}
+			limit := (math.MaxInt64 - long) / longDurationUnits[unit]
+			if amount > float64(limit) {
+				err = errDurationRange
+			}
+			long += time.Duration(amount * float64(longDurationUnits[unit]))
+			return ""
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var short time.Duration
+	if rest != "" {
+		short, err = time.ParseDuration(rest)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if short > math.MaxInt64-long {
+		return 0, errDurationRange
+	}
+
+	if sign == "-" {
+		return -(long + short), nil
+	}
+	return long + short, nil
+}
+
+// Formats a duration the way parseDuration accepts it, using whole
+// days where possible and dropping zero-valued trailing units,
+// e.g. 36 hours becomes "1d12h"
+func formatDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+
+	days := d / day
+	rest := d % day
+	formatted := ""
+	if days > 0 {
+		formatted = strconv.FormatInt(int64(days), 10) + "d"
+	}
+	if rest != 0 || days == 0 {
+		restString := rest.String()
+		if strings.HasSuffix(restString, "m0s") {
+			restString = strings.TrimSuffix(restString, "0s")
+		}
+		if strings.HasSuffix(restString, "h0m") {
+			restString = strings.TrimSuffix(restString, "0m")
+		}
+		formatted += restString
+	}
+	return sign + formatted
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	. "gopkg.in/check.v1"
+	"testing"
+	"time"
+)
+
+type DurationSuite struct{}
+
+func TestDuration(t *testing.T) {
+	Suite(&DurationSuite{})
+	TestingT(t)
+}
+
+func (s *DurationSuite) TestParseDuration(c *C) {
+	cases := map[string]time.Duration{
+		"30s":     30 * time.Second,
+		"1h30m":   90 * time.Minute,
+		"1d12h":   36 * time.Hour,
+		"2w":      14 * 24 * time.Hour,
+		"1.5d":    36 * time.Hour,
+		"-1d12h":  -36 * time.Hour,
+		"1w1d1ms": 8*24*time.Hour + time.Millisecond,
+		"0":       0,
+	}
+	for input, expected := range cases {
+		d, err := parseDuration(input)
+		c.Assert(err, IsNil)
+		c.Assert(d, Equals, expected, Commentf("input %s", input))
+	}
+
+	for _, input := range []string{"", "30", "1x", "d", "1d-1h"} {
+		_, err := parseDuration(input)
+		c.Assert(err, NotNil, Commentf("input %s", input))
+	}
+
+	for _, input := range []string{"300000w", "2000000d", "106751d24h"} {
+		_, err := parseDuration(input)
+		c.Assert(
+			err,
+			ErrorMatches,
+			"duration out of range",
+			Commentf("input %s", input),
+		)
+	}
+}
+
+func (s *DurationSuite) TestFormatDuration(c *C) {
+	cases := map[time.Duration]string{
+		0:                    "0s",
+		30 * time.Second:     "30s",
+		90 * time.Minute:     "1h30m",
+		36 * time.Hour:       "1d12h",
+		48 * time.Hour:       "2d",
+		-25 * time.Hour:      "-1d1h",
+		time.Millisecond:     "1ms",
+		day + 90*time.Second: "1d1m30s",
+	}
+	for input, expected := range cases {
+		c.Assert(formatDuration(input), Equals, expected)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Finds the environment variable to read each field from, which is
+// either set explicitly with Field.EnvVar or derived from the field's
+// file category and key when the config has an EnvPrefix.  Fields
+// without one are left out.
+func (c *Config) envVarNames() map[*Field]string {
+	names := map[*Field]string{}
+	fieldsByName := map[string]*Field{}
+	for _, key := range c.fieldKeysInOrder {
+		field := c.fields[key]
+		name := field.envVar
+		if !field.envVarSet && c.envPrefixSet && field.fileKey != "" {
+			name = deriveEnvVarName(
+				c.envPrefix,
+				field.fileCategory,
+				field.fileKey,
+			)
+		}
+		if name == "" {
+			continue
+		}
+
+		if _, ok := fieldsByName[name]; ok {
+			panic(
+				fmt.Errorf(
+					"conflag: Environment variable %s used twice",
+					name,
+				),
+			)
+		}
+		fieldsByName[name] = field
+		names[field] = name
+	}
+	return names
+}
+
+// Builds a variable name like MYAPP_DATABASE_HOST from a prefix, file
+// category and file key, replacing anything that can't appear in a
+// portable variable name with '_'
+func deriveEnvVarName(prefix string, category string, key string) string {
+	parts := []string{}
+	for _, part := range []string{prefix, category, key} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Map(
+		func(r rune) rune {
+			if r < unicode.MaxASCII &&
+				(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return unicode.ToUpper(r)
+			}
+			return '_'
+		},
+		strings.Join(parts, "_"),
+	)
+}
+
+// Reads the value of each field with an environment variable from
+// env, given in the form of os.Environ
+func readEnvironment(names map[*Field]string, env []string) {
+	values := environmentValues(env)
+	for field, name := range names {
+		if value, ok := values[name]; ok {
+			field.setValue("environment variable "+name, value)
+		}
+	}
+}
+
+// Indexes variables given in the form of os.Environ by name
+func environmentValues(env []string) map[string]string {
+	values := make(map[string]string, len(env))
+	for _, v := range env {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) == 2 {
+			values[parts[0]] = parts[1]
+		}
+	}
+	return values
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	. "gopkg.in/check.v1"
+	"strings"
+	"testing"
+)
+
+type EnvironmentSuite struct{}
+
+func TestEnvironment(t *testing.T) {
+	Suite(&EnvironmentSuite{})
+	TestingT(t)
+}
+
+func (s *EnvironmentSuite) TestDeriveEnvVarName(c *C) {
+	c.Assert(
+		deriveEnvVarName("MYAPP", "database.replica", "host_name"),
+		Equals,
+		"MYAPP_DATABASE_REPLICA_HOST_NAME",
+	)
+	c.Assert(deriveEnvVarName("", "", "port"), Equals, "PORT")
+	c.Assert(deriveEnvVarName("my-app", "", "größe"), Equals, "MY_APP_GR__E")
+}
+
+func (s *EnvironmentSuite) TestPrecedence(c *C) {
+	dest := &struct {
+		Port     int
+		Peers    []string
+		Verbose  bool
+		Database struct {
+			Host string
+			User string
+		}
+		Password string `conflag:"env=DB_PASSWORD"`
+		Token    string `conflag:"env="`
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.EnvPrefix("MYAPP")
+	config.ConfigReader(
+		strings.NewReader(
+			"port = 80\npeers = a\n[database]\nhost = file\nuser = file",
+		),
+	)
+	config.Environment(
+		[]string{
+			"MYAPP_PORT=8080",
+			"MYAPP_PEERS=b,c",
+			"MYAPP_VERBOSE=yes",
+			"MYAPP_DATABASE_HOST=env",
+			"MYAPP_PASSWORD=ignored",
+			"DB_PASSWORD=hunter2",
+			"MYAPP_TOKEN=ignored",
+		},
+	)
+	config.Args([]string{"--port", "9090"})
+
+	_, err = config.Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Port, Equals, 9090)
+	c.Assert(dest.Peers, DeepEquals, []string{"b", "c"})
+	c.Assert(dest.Verbose, Equals, true)
+	c.Assert(dest.Database.Host, Equals, "env")
+	c.Assert(dest.Database.User, Equals, "file")
+	c.Assert(dest.Password, Equals, "hunter2")
+	c.Assert(dest.Token, Equals, "")
+}
+
+func (s *EnvironmentSuite) TestNoPrefix(c *C) {
+	dest := &struct{ Port int }{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.Environment([]string{"PORT=80"}).Args([]string{})
+
+	_, err = config.Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Port, Equals, 0)
+
+	_, err = config.EnvPrefix("").Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Port, Equals, 80)
+}
+
+func (s *EnvironmentSuite) TestEnvironmentFailures(c *C) {
+	dest := &struct {
+		Port  uint16
+		Alias string
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.EnvPrefix("MYAPP").Args([]string{})
+	config.Environment([]string{"MYAPP_PORT=http"})
+
+	_, err = config.Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Invalid value for Port from environment variable "+
+			"MYAPP_PORT: Couldn't parse http as unsigned integer.",
+	)
+
+	config.Field("Alias").EnvVar("MYAPP_PORT")
+	c.Assert(
+		func() { config.Read() },
+		PanicMatches,
+		"conflag: Environment variable MYAPP_PORT used twice",
+	)
+	c.Assert(
+		func() { config.Field("Alias").EnvVar("A=B") },
+		PanicMatches,
+		"conflag: Invalid environment variable name A=B.",
+	)
+}
@@ -49,73 +49,99 @@ const (
 	uintFieldType
 	floatFieldType
 	stringFieldType
+	durationFieldType
+	textFieldType
+	flagValueFieldType
+	customFieldType
+	sliceFieldType
+	mapFieldType
 )
 
-var allowedTypes = map[fieldType]map[reflect.Kind]bool{
-	boolFieldType: map[reflect.Kind]bool{
-		reflect.Bool: true,
-	},
-	intFieldType: map[reflect.Kind]bool{
-		reflect.Int:   true,
-		reflect.Int8:  true,
-		reflect.Int16: true,
-		reflect.Int32: true,
-		reflect.Int64: true,
-	},
-	uintFieldType: map[reflect.Kind]bool{
-		reflect.Uint:   true,
-		reflect.Uint8:  true,
-		reflect.Uint16: true,
-		reflect.Uint32: true,
-		reflect.Uint64: true,
-	},
-	floatFieldType: map[reflect.Kind]bool{
-		reflect.Float32: true,
-		reflect.Float64: true,
-	},
-	stringFieldType: map[reflect.Kind]bool{
-		reflect.String: true,
-	},
-}
-
 // Field represents a single field in a configuration.  You can get it
 // from the Config struct using its Field() method, and then set
 // command-line and config-file properties of the field with it.
 type Field struct {
+	name             string
 	destination      reflect.Value
+	decoders         decoderRegistry
 	kind             fieldType
+	elemKind         fieldType
+	keyKind          fieldType
+	pointer          bool
+	separator        rune
+	choices          []string
+	units            Units
+	timeLayout       string
+	counter          bool
+	count            int
+	counted          bool
+	defaultValue     reflect.Value
 	description      string
 	required         bool
 	found            bool
+	source           string
 	parsedValue      string
+	parsedValues     []string
 	longFlag         string
 	shortFlag        rune
 	inverseLongFlag  string
 	inverseShortFlag rune
 	fileCategory     string
 	fileKey          string
+	envVar           string
+	envVarSet        bool
 }
 
 func processField(
 	fields map[string]*Field,
 	fieldKeysInOrder *[]string,
+	decoders decoderRegistry,
 	field reflect.Value,
 	prefix string,
-	name string,
+	structField reflect.StructField,
 ) error {
-	if field.Type().Kind() == reflect.Struct {
-		if prefix != "" {
-			return errors.New(
-				"conflag: Configuration structs may only be nested one level.",
+	// Unexported fields can't be set, and so are skipped, but an
+	// embedded struct of an unexported type still has its exported
+	// fields promoted
+	exported := structField.PkgPath == ""
+	embeddedStruct := structField.Anonymous &&
+		field.Type().Kind() == reflect.Struct
+	if !exported && !embeddedStruct {
+		return nil
+	}
+	if structField.Tag.Get("conflag") == "-" {
+		return nil
+	}
+
+	name := structField.Name
+	kind := decoders.fieldType(field.Type())
+	key := name
+	if prefix != "" {
+		key = prefix + "." + key
+	}
+
+	tag := structField.Tag.Get("conflag")
+	if kind == invalidFieldType && field.Type().Kind() == reflect.Struct {
+		if tag != "" {
+			return fmt.Errorf(
+				"conflag: Struct field %s may only be tagged with \"-\".",
+				key,
 			)
 		}
+
+		// Embedded structs have their fields promoted into the
+		// enclosing struct's namespace, just as Go does
+		if structField.Anonymous {
+			key = prefix
+		}
 		for i := 0; i < field.NumField(); i++ {
 			err := processField(
 				fields,
 				fieldKeysInOrder,
+				decoders,
 				field.FieldByIndex([]int{i}),
-				name,
-				field.Type().Field(i).Name,
+				key,
+				field.Type().Field(i),
 			)
 			if err != nil {
 				return err
@@ -124,17 +150,57 @@ func processField(
 		return nil
 	}
 
-	kind := invalidFieldType
-	for currentKind, subMap := range allowedTypes {
-		if _, ok := subMap[field.Type().Kind()]; ok {
-			kind = currentKind
-			break
+	pointer := false
+	if kind == invalidFieldType && field.Type().Kind() == reflect.Ptr {
+		pointer = true
+		kind = decoders.fieldType(field.Type().Elem())
+		if kind == invalidFieldType {
+			return fmt.Errorf(
+				"conflag: Type pointer to %s is not allowed in configuration structs.",
+				field.Type().Elem().String(),
+			)
+		}
+	}
+	elemKind := invalidFieldType
+	if kind == invalidFieldType && field.Type().Kind() == reflect.Slice {
+		kind = sliceFieldType
+		elemKind = decoders.fieldType(field.Type().Elem())
+		if elemKind == invalidFieldType {
+			return fmt.Errorf(
+				"conflag: Type slice of %s is not allowed in configuration structs.",
+				field.Type().Elem().String(),
+			)
+		}
+	}
+	// Arrays are read just as slices are, but must be given exactly
+	// as many elements as they hold
+	if kind == invalidFieldType && field.Type().Kind() == reflect.Array {
+		kind = sliceFieldType
+		elemKind = decoders.fieldType(field.Type().Elem())
+		if elemKind == invalidFieldType {
+			return fmt.Errorf(
+				"conflag: Type array of %s is not allowed in configuration structs.",
+				field.Type().Elem().String(),
+			)
+		}
+	}
+	keyKind := invalidFieldType
+	if kind == invalidFieldType && field.Type().Kind() == reflect.Map {
+		kind = mapFieldType
+		keyKind = decoders.fieldType(field.Type().Key())
+		elemKind = decoders.fieldType(field.Type().Elem())
+		if keyKind == invalidFieldType || elemKind == invalidFieldType {
+			return fmt.Errorf(
+				"conflag: Type map of %s to %s is not allowed in configuration structs.",
+				field.Type().Key().String(),
+				field.Type().Elem().String(),
+			)
 		}
 	}
 	if kind == invalidFieldType {
 		return fmt.Errorf(
 			"conflag: Type %s is not allowed in configuration structs.",
-			field.Type().Kind().String(),
+			field.Type().String(),
 		)
 	}
 
@@ -154,26 +220,88 @@ func processField(
 		longFlag = strings.Replace(fileCategory, "_", "-", -1) + "." + longFlag
 	}
 
-	key := name
-	if prefix != "" {
-		key = prefix + "." + key
+	if _, ok := fields[key]; ok {
+		return fmt.Errorf(
+			"conflag: Field %s is defined more than once.",
+			key,
+		)
 	}
 
 	fields[key] = &Field{
+		name:         key,
 		description:  "",
 		destination:  field,
+		decoders:     decoders,
 		kind:         kind,
+		elemKind:     elemKind,
+		keyKind:      keyKind,
+		pointer:      pointer,
+		separator:    ',',
+		units:        NoUnits,
 		required:     false,
 		found:        false,
+		source:       "",
 		parsedValue:  "",
+		parsedValues: []string{},
 		longFlag:     longFlag,
 		shortFlag:    0,
 		fileCategory: fileCategory,
 		fileKey:      fileKey,
 	}
+	fields[key].captureDefault()
 	*fieldKeysInOrder = append(*fieldKeysInOrder, key)
+	fields[key].choices = registeredChoices(fields[key])
+
+	return fields[key].applyTag(tag)
+}
 
-	return nil
+// Gets the type of value the field holds, which for pointer fields is
+// the type pointed to
+func (f *Field) valueType() reflect.Type {
+	if f.pointer {
+		return f.destination.Type().Elem()
+	}
+	return f.destination.Type()
+}
+
+// Indicates whether the field is set by a command-line flag alone,
+// without an argument.  This is true of boolean fields and of
+// flag.Value fields that report themselves as boolean flags.
+func (f *Field) isBoolean() bool {
+	if f.kind == boolFieldType {
+		return true
+	}
+	if f.kind == flagValueFieldType {
+		value := reflect.New(f.valueType()).Interface()
+		if boolFlag, ok := value.(interface{ IsBoolFlag() bool }); ok {
+			return boolFlag.IsBoolFlag()
+		}
+	}
+	return false
+}
+
+// Records a raw value for the field read from the named source.
+// Slice and map fields accumulate every value given by a single
+// source, but a new source replaces whatever was read from the
+// previous one.
+func (f *Field) setValue(source string, value string) {
+	multiple := f.kind == sliceFieldType || f.kind == mapFieldType
+	if multiple && f.found && f.source == source {
+		f.parsedValues = append(f.parsedValues, value)
+	} else {
+		f.parsedValues = []string{value}
+	}
+	f.parsedValue = value
+	f.source = source
+	f.found = true
+}
+
+// Records one occurrence of a counter field's flag on the command
+// line, with a delta of 1, or of its inverse flag, with a delta of -1
+func (f *Field) addCount(delta int) {
+	f.count += delta
+	f.counted = true
+	f.found = true
 }
 
 // Description sets the description to use in the usage text for the
@@ -190,6 +318,49 @@ func (f *Field) Required() *Field {
 	return f
 }
 
+// Choices restricts the field to the given set of values, written as
+// they would be in a config file, and lists them in the usage text.
+// For slice and map fields the restriction applies to each element or
+// map value.
+func (f *Field) Choices(choices ...string) *Field {
+	f.choices = choices
+	return f
+}
+
+// Units sets the unit suffixes accepted by a numeric field, or by the
+// elements or map values of a slice or map field, e.g. SIUnits to
+// accept 1.5k for 1500.  Panics for non-numeric fields.
+func (f *Field) Units(units Units) *Field {
+	kind := f.kind
+	if kind == sliceFieldType || kind == mapFieldType {
+		kind = f.elemKind
+	}
+	if kind != intFieldType && kind != uintFieldType && kind != floatFieldType {
+		panic(errors.New("conflag: Only numeric fields may have units."))
+	}
+	f.units = units
+	return f
+}
+
+// Default sets the value the field holds when no config file or
+// command-line flag provides one, written as it would be in a config
+// file.  This replaces any value already set in the destination
+// struct.  Panics if the value can't be decoded for the field.
+func (f *Field) Default(value string) *Field {
+	if err := f.assignValues("", []string{value}); err != nil {
+		panic(err)
+	}
+	f.captureDefault()
+	return f
+}
+
+// Keeps a copy of the destination's value as the field's default, so
+// that usage shows it even after values have been read over it
+func (f *Field) captureDefault() {
+	f.defaultValue = reflect.New(f.destination.Type()).Elem()
+	f.defaultValue.Set(f.destination)
+}
+
 // LongFlag sets the long command-line flag for the option, to be
 // found on the command line in the form --long-flag.
 func (f *Field) LongFlag(flag string) *Field {
@@ -198,12 +369,17 @@ func (f *Field) LongFlag(flag string) *Field {
 }
 
 // InverseLongFlag sets the command-line flag to set the option to
-// false, to be found on the command line in the form
-// --inverse-long-flag.  Only usable on boolean fields.
+// false, or to decrement a counter, to be found on the command line in
+// the form --inverse-long-flag.  Only usable on boolean and counter
+// fields.
 func (f *Field) InverseLongFlag(flag string) *Field {
 	f.inverseLongFlag = flag
-	if f.kind != boolFieldType {
-		panic(errors.New("Only boolean fields may have inverse flags."))
+	if !f.isBoolean() && !f.counter {
+		panic(
+			errors.New(
+				"conflag: Only boolean and counter fields may have inverse flags.",
+			),
+		)
 	}
 	return f
 }
@@ -216,26 +392,79 @@ func (f *Field) ShortFlag(flag rune) *Field {
 }
 
 // InverseShortFlag sets the short command-line flag to set the option
-// to false, to be found on the command line in the form -i.  Only
-// usable on boolean fields.
+// to false, or to decrement a counter, to be found on the command line
+// in the form -i.  Only usable on boolean and counter fields.
 func (f *Field) InverseShortFlag(flag rune) *Field {
 	f.inverseShortFlag = flag
-	if f.kind != boolFieldType {
+	if !f.isBoolean() && !f.counter {
 		panic(
-			errors.New("conflag: Only boolean fields may have inverse flags."),
+			errors.New(
+				"conflag: Only boolean and counter fields may have inverse flags.",
+			),
 		)
 	}
 	return f
 }
 
-// FileCategory sets the config file category the option will be found
-// under.  An empty string indicates none.
-func (f *Field) FileCategory(category string) *Field {
-	if strings.Contains(category, ".") {
+// Counter makes an integer field's command-line flags take no
+// argument, instead adding one to the field's value for each time
+// they're given, so that -vvv means 3.  Inverse flags subtract one,
+// and unsigned counters stop at zero.  The count starts from the value
+// found in the config file, if any, or else the field's default, and
+// config files give the value as a plain number.  Must be set before
+// any inverse flags.  Only usable on integer fields other than
+// pointers.
+func (f *Field) Counter() *Field {
+	if (f.kind != intFieldType && f.kind != uintFieldType) || f.pointer {
+		panic(errors.New("conflag: Only integer fields may be counters."))
+	}
+	f.counter = true
+	return f
+}
+
+// Records a single key/value pair for a map field, as found in the
+// map's own section of a config file.
+func (f *Field) setMapEntry(source string, key string, value string) {
+	f.setValue(source, quoteListElement(key+"="+value))
+}
+
+// Separator sets the character used to split a single value into
+// multiple elements for slice and map fields, e.g. --peer a,b or
+// --label env=prod,team=infra.  Elements may be wrapped in double
+// quotes to include the separator itself.  The default separator is
+// ','.  Only usable on slice and map fields.
+//
+// Slice and map fields collect every value given for them by a config
+// file or the command line, each of which is split in this way.
+// Array fields are read the same way, but must be given exactly as
+// many elements as they hold.  Map entries are written as key=value,
+// and in a config file a map may also be given its own section in
+// which every key becomes an entry.
+func (f *Field) Separator(separator rune) *Field {
+	if f.kind != sliceFieldType && f.kind != mapFieldType {
 		panic(
-			errors.New("conflag: File category names cannot include '.'"),
+			errors.New("conflag: Only slice and map fields may have separators."),
 		)
 	}
+	if separator == '"' || separator == '\\' {
+		panic(errors.New("conflag: Separators cannot be quotes or escapes."))
+	}
+	f.separator = separator
+	return f
+}
+
+// FileCategory sets the config file category the option will be found
+// under.  An empty string indicates none.  Nested categories are
+// separated by '.', e.g. "database.replica" for a [database.replica]
+// section.
+func (f *Field) FileCategory(category string) *Field {
+	for _, part := range strings.Split(category, ".") {
+		if category != "" && part == "" {
+			panic(
+				errors.New("conflag: File category names cannot be empty."),
+			)
+		}
+	}
 	f.fileCategory = category
 	return f
 }
@@ -243,8 +472,22 @@ func (f *Field) FileCategory(category string) *Field {
 // FileKey sets the key in the config file for the option.
 func (f *Field) FileKey(key string) *Field {
 	if strings.Contains(key, ".") {
-		panic(errors.New("File key names cannot include '.'"))
+		panic(errors.New("conflag: File key names cannot include '.'"))
 	}
 	f.fileKey = key
 	return f
 }
+
+// EnvVar sets the environment variable to read the field from, in
+// place of any name derived from the config's EnvPrefix.  An empty
+// name keeps the field from being read from the environment at all.
+func (f *Field) EnvVar(name string) *Field {
+	if strings.ContainsAny(name, "=\x00") {
+		panic(
+			fmt.Errorf("conflag: Invalid environment variable name %s.", name),
+		)
+	}
+	f.envVar = name
+	f.envVarSet = true
+	return f
+}
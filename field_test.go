@@ -135,21 +135,41 @@ func (s *FieldSuite) TestNonStructFails(c *C) {
 	c.Assert(config, IsNil)
 }
 
-func (s *FieldSuite) TestDeepNestingFails(c *C) {
-	dest := struct{ A struct{ B struct{ C int } } }{}
+func (s *FieldSuite) TestDeepNesting(c *C) {
+	dest := struct {
+		Database struct {
+			Replica struct {
+				HostName string
+			}
+		}
+	}{}
 	config, err := New(&dest)
-	c.Assert(err, NotNil)
-	c.Assert(config, IsNil)
+	c.Assert(err, IsNil)
+	c.Assert(config, NotNil)
+
+	field := config.Field("Database.Replica.HostName")
+	c.Assert(field.longFlag, Equals, "database.replica.host-name")
+	c.Assert(field.fileCategory, Equals, "database.replica")
+	c.Assert(field.fileKey, Equals, "host_name")
 }
 
 func (s *FieldSuite) TestWrongFieldTypeFails(c *C) {
-	dest := struct{ A *int }{}
+	dest := struct{ A chan int }{}
 	config, err := New(&dest)
 	c.Assert(err, NotNil)
 	c.Assert(config, IsNil)
 }
 
-func (s *FieldSuite) TestCategoryWithDotFails(c *C) {
+func (s *FieldSuite) TestNestedCategory(c *C) {
+	config, err := New(&s.dest)
+	c.Assert(err, IsNil)
+	c.Assert(config, NotNil)
+
+	field := config.Field("UintField").FileCategory("test.category")
+	c.Assert(field.fileCategory, Equals, "test.category")
+}
+
+func (s *FieldSuite) TestEmptyCategoryPartFails(c *C) {
 	defer func() {
 		c.Assert(recover(), NotNil)
 	}()
@@ -158,7 +178,7 @@ func (s *FieldSuite) TestCategoryWithDotFails(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(config, NotNil)
 
-	config.Field("UintField").FileCategory("test.category")
+	config.Field("UintField").FileCategory("test..category")
 }
 
 func (s *FieldSuite) TestKeyWithDotFails(c *C) {
@@ -172,3 +192,175 @@ func (s *FieldSuite) TestKeyWithDotFails(c *C) {
 
 	config.Field("UintField").FileKey("test.key")
 }
+
+func (s *FieldSuite) TestSliceField(c *C) {
+	dest := struct{ Ports []uint16 }{}
+	config, err := New(&dest)
+	c.Assert(err, IsNil)
+
+	field := config.Field("Ports")
+	c.Assert(field.kind, Equals, sliceFieldType)
+	c.Assert(field.elemKind, Equals, uintFieldType)
+	c.Assert(field.separator, Equals, ',')
+	c.Assert(field.Separator(';').separator, Equals, ';')
+}
+
+func (s *FieldSuite) TestWrongSliceTypeFails(c *C) {
+	dest := struct{ A [][]int }{}
+	config, err := New(&dest)
+	c.Assert(err, NotNil)
+	c.Assert(config, IsNil)
+}
+
+func (s *FieldSuite) TestSeparatorFailure(c *C) {
+	config, err := New(&s.dest)
+	c.Assert(err, IsNil)
+	c.Assert(config, NotNil)
+
+	defer func() {
+		c.Assert(recover(), NotNil)
+	}()
+	config.Field("StringField").Separator(';')
+}
+
+func (s *FieldSuite) TestMapField(c *C) {
+	dest := struct{ Labels map[string]int }{}
+	config, err := New(&dest)
+	c.Assert(err, IsNil)
+
+	field := config.Field("Labels")
+	c.Assert(field.kind, Equals, mapFieldType)
+	c.Assert(field.keyKind, Equals, stringFieldType)
+	c.Assert(field.elemKind, Equals, intFieldType)
+}
+
+func (s *FieldSuite) TestWrongMapTypeFails(c *C) {
+	dest := struct{ A map[string][]int }{}
+	config, err := New(&dest)
+	c.Assert(err, NotNil)
+	c.Assert(config, IsNil)
+}
+
+func (s *FieldSuite) TestSelfDecodingField(c *C) {
+	dest := struct {
+		Level  testLevel
+		Pair   testPair
+		Switch testSwitch
+	}{}
+	config, err := New(&dest)
+	c.Assert(err, IsNil)
+
+	c.Assert(config.Field("Level").kind, Equals, textFieldType)
+	c.Assert(config.Field("Pair").kind, Equals, flagValueFieldType)
+	c.Assert(config.Field("Pair").isBoolean(), Equals, false)
+	c.Assert(config.Field("Switch").isBoolean(), Equals, true)
+}
+
+func (s *FieldSuite) TestPointerField(c *C) {
+	dest := struct {
+		Retries *int
+		Verbose *bool
+		Switch  *testSwitch
+	}{}
+	config, err := New(&dest)
+	c.Assert(err, IsNil)
+
+	field := config.Field("Retries")
+	c.Assert(field.kind, Equals, intFieldType)
+	c.Assert(field.pointer, Equals, true)
+	c.Assert(config.Field("Verbose").isBoolean(), Equals, true)
+	c.Assert(config.Field("Switch").isBoolean(), Equals, true)
+}
+
+func (s *FieldSuite) TestWrongPointerTypeFails(c *C) {
+	dest := struct{ A *[]int }{}
+	config, err := New(&dest)
+	c.Assert(err, NotNil)
+	c.Assert(config, IsNil)
+}
+
+func (s *FieldSuite) TestEmbeddedStructPromotion(c *C) {
+	dest := struct {
+		testCommonOptions
+		Primary testDBConfig
+		Replica testDBConfig
+	}{}
+	config, err := New(&dest)
+	c.Assert(err, IsNil)
+
+	c.Assert(
+		config.fieldKeysInOrder,
+		DeepEquals,
+		[]string{
+			"Verbose",
+			"LogFile",
+			"Primary.Host",
+			"Primary.Port",
+			"Replica.Host",
+			"Replica.Port",
+		},
+	)
+	verbose := config.Field("Verbose")
+	c.Assert(verbose.fileCategory, Equals, "")
+	c.Assert(verbose.fileKey, Equals, "verbose")
+	c.Assert(verbose.longFlag, Equals, "verbose")
+	c.Assert(config.Field("Replica.Host").fileCategory, Equals, "replica")
+	c.Assert(config.Field("Replica.Host").longFlag, Equals, "replica.host")
+}
+
+func (s *FieldSuite) TestNestedEmbeddedStructPromotion(c *C) {
+	dest := struct {
+		Server struct {
+			testDBConfig
+			Name string
+		}
+	}{}
+	config, err := New(&dest)
+	c.Assert(err, IsNil)
+
+	field := config.Field("Server.Host")
+	c.Assert(field.fileCategory, Equals, "server")
+	c.Assert(field.longFlag, Equals, "server.host")
+}
+
+func (s *FieldSuite) TestPromotedFieldCollisionFails(c *C) {
+	dest := struct {
+		testCommonOptions
+		Verbose bool
+	}{}
+	config, err := New(&dest)
+	c.Assert(err, NotNil)
+	c.Assert(config, IsNil)
+}
+
+func (s *FieldSuite) TestSkippedFields(c *C) {
+	dest := struct {
+		testCommonOptions
+		Name    string
+		Runtime chan int `conflag:"-"`
+		helper  func()
+		cache   map[string][]int
+	}{}
+	config, err := New(&dest)
+	c.Assert(err, IsNil)
+	c.Assert(
+		config.fieldKeysInOrder,
+		DeepEquals,
+		[]string{"Verbose", "LogFile", "Name"},
+	)
+}
+
+func (s *FieldSuite) TestDefault(c *C) {
+	config, err := New(&s.dest)
+	c.Assert(err, IsNil)
+
+	config.Field("IntField").Default("42")
+	config.Field("StructField.StringField").Default("text")
+	c.Assert(s.dest.IntField, Equals, 42)
+	c.Assert(s.dest.StructField.StringField, Equals, "text")
+
+	defer func() {
+		c.Assert(recover(), NotNil)
+	}()
+	config.Field("UintField").Default("-1")
+}
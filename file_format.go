@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// FileFormat selects the syntax of a config file, as set with
+// Config.ConfigFormat.
+type FileFormat int
+
+const (
+	// INIFormat reads key = value lines grouped into [category]
+	// sections.  This is the default.
+	INIFormat FileFormat = iota
+	// JSONFormat reads a JSON object, in which each key is a file key
+	// and each nested object a category.  Values must have the JSON
+	// type suited to their field, e.g. a number for an int field or an
+	// array for a slice field, except that numbers with units are
+	// given as strings.
+	JSONFormat
+	// TOMLFormat reads a TOML document, in which each key is a file
+	// key and each table a category.  Values keep their TOML types, so
+	// that integers, floats, booleans, datetimes and arrays must suit
+	// the fields they're read into, much as in JSON.
+	TOMLFormat
+	// YAMLFormat reads a YAML mapping, in which each key is a file key
+	// and each nested mapping a category.  Only the common subset of
+	// YAML is supported, without anchors, tags or multiple documents.
+	YAMLFormat
+)
+
+// The formats of files with these extensions, regardless of the
+// config's default format
+var fileFormatExtensions = map[string]FileFormat{
+	".ini":  INIFormat,
+	".json": JSONFormat,
+	".toml": TOMLFormat,
+	".yaml": YAMLFormat,
+	".yml":  YAMLFormat,
+}
+
+// Chooses the format of a config file from its extension, falling
+// back to the config's default
+func (c *Config) configFileFormat(name string) FileFormat {
+	extension := strings.ToLower(filepath.Ext(name))
+	if format, ok := fileFormatExtensions[extension]; ok {
+		return format
+	}
+	return c.fileFormat
+}
+
+// Reads a config file in the given format into the fields
+func readConfigFileFormat(
+	format FileFormat,
+	dest map[string]*Field,
+	src io.Reader,
+	source string,
+) error {
+	switch format {
+	case JSONFormat:
+		return readJSONConfigFile(dest, src, source)
+	case TOMLFormat:
+		return readTOMLConfigFile(dest, src, source)
+	case YAMLFormat:
+		return readYAMLConfigFile(dest, src, source)
+	default:
+		return readConfigFile(dest, src, source)
+	}
+}
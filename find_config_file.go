@@ -34,21 +34,38 @@ package conflag
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 )
 
-func (c *Config) findConfigFile() (
-	f io.Reader,
+// A config file to read, given either by name, as an open reader, as
+// a relative path to search for or as a directory of fragments
+type configFile struct {
+	name      string
+	reader    io.Reader
+	required  bool
+	search    string
+	searchAll bool
+	dir       string
+	pattern   string
+	source    string
+	format    FileFormat
+}
+
+// Finds the config files to read, in order, opening any given by name.
+// Files named on the command line replace any set on the config other
+// than directories, and must exist.  Directories are read last.  Returns the command-line
+// arguments with the config file flags removed.
+func (c *Config) findConfigFiles() (
+	files []configFile,
 	args []string,
 	err error,
 ) {
-	err = nil
-	f = c.file
+	files = c.files
 	args = c.args
 
-	fileName := c.fileName
-	foundFlag := false
 	if c.fileShortFlag != 0 || c.fileLongFlag != "" {
 		shortFlag := ""
 		longFlag := ""
@@ -59,37 +76,198 @@ func (c *Config) findConfigFile() (
 			longFlag = "--" + c.fileLongFlag
 		}
 
-		for i := len(args) - 1; i >= 0; i-- {
-			if args[i] == longFlag || args[i] == shortFlag {
-				if foundFlag {
-					if closer, ok := f.(io.Closer); ok {
-						closer.Close()
-					}
-					f = nil
-					err = errors.New("conflag: Duplicate config file flags")
-					return
-				} else {
-					foundFlag = true
-				}
+		flagged := []configFile{}
+		// Removing file names and flags from the args so they don't
+		// cause problems later
+		args = []string{}
+		for i := 0; i < len(c.args); i++ {
+			if c.args[i] != longFlag && c.args[i] != shortFlag {
+				args = append(args, c.args[i])
+				continue
+			}
+			if i+1 > len(c.args)-1 {
+				closeConfigFiles(c.files)
+				return nil, nil, errors.New("conflag: Missing config file name")
+			}
+			i++
+			flagged = append(
+				flagged,
+				configFile{name: c.args[i], required: true},
+			)
+		}
 
-				if i+1 > len(args)-1 {
-					err = errors.New("conflag: Missing config file name")
-					return
+		if len(flagged) > 0 {
+			closeConfigFiles(c.files)
+			files = flagged
+			for _, file := range c.files {
+				if file.dir != "" {
+					files = append(files, file)
 				}
+			}
+		}
+	}
+
+	// Directories of fragments merge over every other config file,
+	// whatever order they were added in
+	ordered := []configFile{}
+	for _, file := range files {
+		if file.dir == "" {
+			ordered = append(ordered, file)
+		}
+	}
+	for _, file := range files {
+		if file.dir != "" {
+			ordered = append(ordered, file)
+		}
+	}
+
+	files, err = c.expandConfigFiles(ordered)
+	if err != nil {
+		return nil, nil, err
+	}
+	opened := []configFile{}
+	for i, file := range files {
+		if file.reader == nil {
+			reader, err := os.Open(file.name)
+			if os.IsNotExist(err) && !file.required {
+				continue
+			}
+			if err != nil {
+				closeConfigFiles(opened)
+				closeConfigFiles(files[i+1:])
+				return nil, nil, fmt.Errorf(
+					"conflag: Couldn't open config file: %s.",
+					err,
+				)
+			}
+			file.reader = reader
+		}
+
+		// Each file is a separate source, so that slice and map values
+		// in later files replace those in earlier ones
+		switch {
+		case file.name != "":
+			file.source = "config file " + file.name
+		case len(files) > 1:
+			file.source = fmt.Sprintf("config file #%d", i+1)
+		default:
+			file.source = configFileSource
+		}
+		file.format = c.configFileFormat(file.name)
+		opened = append(opened, file)
+	}
+
+	if len(opened) == 0 && c.fileRequired {
+		return nil, nil, errors.New("conflag: Required config file not found.")
+	}
+	return opened, args, nil
+}
+
+// Replaces each config file to search for, and each directory of
+// fragments, with the files found, in the order they're to be read
+func (c *Config) expandConfigFiles(
+	files []configFile,
+) ([]configFile, error) {
+	expanded := []configFile{}
+	for i, file := range files {
+		if file.dir != "" {
+			fragments, err := configDirFiles(file.dir, file.pattern)
+			if err != nil {
+				closeConfigFiles(expanded)
+				closeConfigFiles(files[i+1:])
+				return nil, err
+			}
+			expanded = append(expanded, fragments...)
+			continue
+		}
+		if file.search == "" {
+			expanded = append(expanded, file)
+			continue
+		}
 
-				fileName = args[i+1]
-				// Removing file names and flags from the args so they
-				// don't cause problems later
-				args = append(args[:i], args[i+2:]...)
+		paths := c.configSearchPaths(file.search)
+		if !file.searchAll {
+			for _, path := range paths {
+				if _, err := os.Stat(path); err == nil {
+					expanded = append(expanded, configFile{name: path})
+					break
+				}
 			}
+			continue
+		}
+		// Missing files are skipped when opened
+		for i := len(paths) - 1; i >= 0; i-- {
+			expanded = append(expanded, configFile{name: paths[i]})
+		}
+	}
+	return expanded, nil
+}
+
+// Lists the regular files in a directory matching a pattern, in
+// lexical order.  A missing directory has no files.
+func configDirFiles(dir string, pattern string) ([]configFile, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("conflag: Couldn't read config directory: %s.", err)
+	}
+
+	files := []configFile{}
+	for _, entry := range entries {
+		if matched, _ := filepath.Match(pattern, entry.Name()); !matched {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err == nil && info.Mode().IsRegular() {
+			files = append(files, configFile{name: path})
 		}
 	}
+	return files, nil
+}
+
+// Lists the places to search for a config file, from the most to the
+// least important.  Relative directories in the XDG variables are
+// ignored, as the specification requires.
+func (c *Config) configSearchPaths(path string) []string {
+	env := environmentValues(c.env)
+	dirs := []string{}
+
+	home := env["XDG_CONFIG_HOME"]
+	if !filepath.IsAbs(home) && env["HOME"] != "" {
+		home = filepath.Join(env["HOME"], ".config")
+	}
+	if filepath.IsAbs(home) {
+		dirs = append(dirs, home)
+	}
+
+	configDirs := env["XDG_CONFIG_DIRS"]
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	for _, dir := range filepath.SplitList(configDirs) {
+		if filepath.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	paths := []string{}
+	for _, dir := range dirs {
+		paths = append(paths, filepath.Join(dir, path))
+	}
+	for _, dir := range c.searchFallbacks {
+		paths = append(paths, filepath.Join(dir, filepath.Base(path)))
+	}
+	return paths
+}
 
-	if (f == nil && fileName != "") || foundFlag {
-		if closer, ok := f.(io.Closer); ok {
+// Closes any of the files' readers that are io.Closers
+func closeConfigFiles(files []configFile) {
+	for _, file := range files {
+		if closer, ok := file.reader.(io.Closer); ok {
 			closer.Close()
 		}
-		f, err = os.Open(fileName)
 	}
-	return
 }
@@ -38,6 +38,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -87,41 +88,43 @@ func TestFindConfigFile(t *testing.T) {
 
 func (s *FindConfigFileSuite) TestNothing(c *C) {
 	s.config.Args([]string{"some", "random", "flags"})
-	fin, _, err := s.config.findConfigFile()
-	c.Assert(fin, IsNil)
+	files, _, err := s.config.findConfigFiles()
 	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
 }
 
 func (s *FindConfigFileSuite) TestDefaultReader(c *C) {
 	s.config.ConfigReader(s.defaultTestFileReader)
 	s.config.Args([]string{"some", "random", "flags"})
-	fin, _, err := s.config.findConfigFile()
+	files, _, err := s.config.findConfigFiles()
 	c.Assert(err, IsNil)
-	assertFileContents(c, fin, "DEFAULT_READER")
+	assertFileContents(c, files, "DEFAULT_READER")
+	c.Assert(files[0].source, Equals, configFileSource)
 }
 
 func (s *FindConfigFileSuite) TestDefaultFile(c *C) {
 	s.config.ConfigFile(s.defaultTestFileName)
 	s.config.Args([]string{"some", "random", "flags"})
-	fin, _, err := s.config.findConfigFile()
+	files, _, err := s.config.findConfigFiles()
 	c.Assert(err, IsNil)
-	assertFileContents(c, fin, "DEFAULT_FILE")
+	assertFileContents(c, files, "DEFAULT_FILE")
+	c.Assert(files[0].source, Equals, "config file "+s.defaultTestFileName)
 }
 
 func (s *FindConfigFileSuite) TestShortFlag(c *C) {
 	s.config.ConfigFileShortFlag('c')
 	s.config.Args([]string{"-c", s.extraTestFileName})
-	fin, _, err := s.config.findConfigFile()
+	files, _, err := s.config.findConfigFiles()
 	c.Assert(err, IsNil)
-	assertFileContents(c, fin, "EXTRA_FILE")
+	assertFileContents(c, files, "EXTRA_FILE")
 }
 
 func (s *FindConfigFileSuite) TestLongFlag(c *C) {
 	s.config.ConfigFileLongFlag("config-file")
 	s.config.Args([]string{"--config-file", s.extraTestFileName})
-	fin, _, err := s.config.findConfigFile()
+	files, _, err := s.config.findConfigFiles()
 	c.Assert(err, IsNil)
-	assertFileContents(c, fin, "EXTRA_FILE")
+	assertFileContents(c, files, "EXTRA_FILE")
 }
 
 func (s *FindConfigFileSuite) TestShortFlagOverrideReader(c *C) {
@@ -132,19 +135,19 @@ func (s *FindConfigFileSuite) TestShortFlagOverrideReader(c *C) {
 	s.config.ConfigReader(reader)
 	s.config.ConfigFileShortFlag('c')
 	s.config.Args([]string{"-c", s.extraTestFileName})
-	fin, _, err := s.config.findConfigFile()
+	files, _, err := s.config.findConfigFiles()
 	c.Assert(err, IsNil)
 	c.Assert(reader.closed, Equals, true)
-	assertFileContents(c, fin, "EXTRA_FILE")
+	assertFileContents(c, files, "EXTRA_FILE")
 }
 
 func (s *FindConfigFileSuite) TestShortFlagOverrideFileName(c *C) {
 	s.config.ConfigFile(s.defaultTestFileName)
 	s.config.ConfigFileShortFlag('c')
 	s.config.Args([]string{"-c", s.extraTestFileName})
-	fin, _, err := s.config.findConfigFile()
+	files, _, err := s.config.findConfigFiles()
 	c.Assert(err, IsNil)
-	assertFileContents(c, fin, "EXTRA_FILE")
+	assertFileContents(c, files, "EXTRA_FILE")
 }
 
 func (s *FindConfigFileSuite) TestLongFlagOverrideFileReader(c *C) {
@@ -155,19 +158,19 @@ func (s *FindConfigFileSuite) TestLongFlagOverrideFileReader(c *C) {
 	s.config.ConfigReader(reader)
 	s.config.ConfigFileLongFlag("config-file")
 	s.config.Args([]string{"--config-file", s.extraTestFileName})
-	fin, _, err := s.config.findConfigFile()
+	files, _, err := s.config.findConfigFiles()
 	c.Assert(err, IsNil)
 	c.Assert(reader.closed, Equals, true)
-	assertFileContents(c, fin, "EXTRA_FILE")
+	assertFileContents(c, files, "EXTRA_FILE")
 }
 
 func (s *FindConfigFileSuite) TestLongFlagOverrideFileName(c *C) {
 	s.config.ConfigFile(s.defaultTestFileName)
 	s.config.ConfigFileLongFlag("config-file")
 	s.config.Args([]string{"--config-file", s.extraTestFileName})
-	fin, _, err := s.config.findConfigFile()
+	files, _, err := s.config.findConfigFiles()
 	c.Assert(err, IsNil)
-	assertFileContents(c, fin, "EXTRA_FILE")
+	assertFileContents(c, files, "EXTRA_FILE")
 }
 
 func (s *FindConfigFileSuite) TestMultipleFlags(c *C) {
@@ -178,41 +181,237 @@ func (s *FindConfigFileSuite) TestMultipleFlags(c *C) {
 	s.config.ConfigReader(reader)
 	s.config.ConfigFileShortFlag('c')
 	s.config.ConfigFileLongFlag("config-file")
-	s.config.Args([]string{"-c", "file", "--config-file", "otherfile"})
-	fin, _, err := s.config.findConfigFile()
-	c.Assert(fin, IsNil)
-	c.Assert(err, NotNil)
+	s.config.Args(
+		[]string{
+			"-c", s.extraTestFileName,
+			"--config-file", s.defaultTestFileName,
+		},
+	)
+	files, _, err := s.config.findConfigFiles()
+	c.Assert(err, IsNil)
 	c.Assert(reader.closed, Equals, true)
+	assertFileContents(c, files, "EXTRA_FILE", "DEFAULT_FILE")
+}
+
+func (s *FindConfigFileSuite) TestMultipleFiles(c *C) {
+	s.config.ConfigFile(s.defaultTestFileName)
+	s.config.ConfigFile("/missing/file")
+	s.config.ConfigReader(s.defaultTestFileReader)
+	s.config.RequiredConfigFile(s.extraTestFileName)
+	s.config.Args([]string{})
+	files, _, err := s.config.findConfigFiles()
+	c.Assert(err, IsNil)
+	c.Assert(files[1].source, Equals, "config file #3")
+	assertFileContents(
+		c,
+		files,
+		"DEFAULT_FILE",
+		"DEFAULT_READER",
+		"EXTRA_FILE",
+	)
 }
 
 func (s *FindConfigFileSuite) TestFileNameRemoval(c *C) {
 	s.config.ConfigFileLongFlag("config-file")
-	s.config.Args([]string{"a", "b", "--config-file", s.defaultTestFileName})
-	fin, args, err := s.config.findConfigFile()
-	c.Assert(fin, NotNil)
+	args := []string{"a", "--config-file", s.defaultTestFileName, "b"}
+	s.config.Args(args)
+	files, remaining, err := s.config.findConfigFiles()
 	c.Assert(err, IsNil)
-	c.Assert(args, DeepEquals, []string{"a", "b"})
+	c.Assert(files, HasLen, 1)
+	c.Assert(remaining, DeepEquals, []string{"a", "b"})
+	c.Assert(args[1], Equals, "--config-file")
+	closeConfigFiles(files)
 }
 
 func (s *FindConfigFileSuite) TestMissingFile(c *C) {
 	s.config.ConfigFileShortFlag('c')
 	s.config.Args([]string{"-c", "/missing/file/"})
-	fin, _, err := s.config.findConfigFile()
-	c.Assert(fin, IsNil)
+	files, _, err := s.config.findConfigFiles()
+	c.Assert(files, IsNil)
 	c.Assert(err, NotNil)
 
 	s.config.ConfigFile("/missing/file/")
 	s.config.Args([]string{"-c", "/missing/file"})
-	fin, _, err = s.config.findConfigFile()
-	c.Assert(fin, IsNil)
+	files, _, err = s.config.findConfigFiles()
+	c.Assert(files, IsNil)
 	c.Assert(err, NotNil)
+
+	config, err := New(&testConfig{})
+	c.Assert(err, IsNil)
+	reader := &closerStringReader{
+		Reader: s.defaultTestFileReader,
+		closed: false,
+	}
+	config.ConfigReader(reader).RequiredConfigFile("/missing/file")
+	files, _, err = config.Args([]string{}).findConfigFiles()
+	c.Assert(files, IsNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Couldn't open config file: open /missing/file: no such "+
+			"file or directory.",
+	)
+	c.Assert(reader.closed, Equals, true)
+}
+
+func (s *FindConfigFileSuite) TestRequiredFile(c *C) {
+	s.config.ConfigFile("/missing/file").ConfigFileRequired()
+	s.config.Args([]string{})
+	files, _, err := s.config.findConfigFiles()
+	c.Assert(files, IsNil)
+	c.Assert(err, NotNil)
+	c.Assert(err.Error(), Equals, "conflag: Required config file not found.")
 }
 
-func assertFileContents(c *C, fin io.Reader, expected string) {
-	bytes, err := ioutil.ReadAll(fin)
+func assertFileContents(c *C, files []configFile, expected ...string) {
+	c.Assert(files, HasLen, len(expected))
+	for i, file := range files {
+		bytes, err := ioutil.ReadAll(file.reader)
+		c.Assert(err, IsNil)
+		c.Assert(string(bytes), Equals, expected[i])
+		if closer, ok := file.reader.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+func (s *FindConfigFileSuite) TestConfigSearchPaths(c *C) {
+	s.config.ConfigSearchFallbacks("/etc/myapp", ".")
+	s.config.Environment(
+		[]string{"HOME=/home/me", "XDG_CONFIG_DIRS=/opt/xdg:relative:/etc/xdg"},
+	)
+	c.Assert(
+		s.config.configSearchPaths("myapp/config.ini"),
+		DeepEquals,
+		[]string{
+			"/home/me/.config/myapp/config.ini",
+			"/opt/xdg/myapp/config.ini",
+			"/etc/xdg/myapp/config.ini",
+			"/etc/myapp/config.ini",
+			"config.ini",
+		},
+	)
+
+	s.config.ConfigSearchFallbacks()
+	s.config.Environment(
+		[]string{"HOME=/home/me", "XDG_CONFIG_HOME=/xdg/home"},
+	)
+	c.Assert(
+		s.config.configSearchPaths("myapp/config.ini"),
+		DeepEquals,
+		[]string{"/xdg/home/myapp/config.ini", "/etc/xdg/myapp/config.ini"},
+	)
+}
+
+func (s *FindConfigFileSuite) TestSearchConfigFile(c *C) {
+	home := c.MkDir()
+	system := c.MkDir()
+	fallback := c.MkDir()
+	for path, contents := range map[string]string{
+		filepath.Join(system, "myapp", "config.ini"): "SYSTEM",
+		filepath.Join(fallback, "config.ini"):        "FALLBACK",
+	} {
+		c.Assert(os.MkdirAll(filepath.Dir(path), 0777), IsNil)
+		c.Assert(ioutil.WriteFile(path, []byte(contents), 0666), IsNil)
+	}
+	s.config.Environment(
+		[]string{"XDG_CONFIG_HOME=" + home, "XDG_CONFIG_DIRS=" + system},
+	)
+	s.config.ConfigSearchFallbacks(fallback).Args([]string{})
+
+	s.config.SearchConfigFile("myapp/config.ini")
+	files, _, err := s.config.findConfigFiles()
+	c.Assert(err, IsNil)
+	assertFileContents(c, files, "SYSTEM")
+
+	s.config.files = nil
+	s.config.SearchConfigFiles("myapp/config.ini")
+	files, _, err = s.config.findConfigFiles()
+	c.Assert(err, IsNil)
+	assertFileContents(c, files, "FALLBACK", "SYSTEM")
+
+	s.config.files = nil
+	s.config.SearchConfigFile("other/config.ini").ConfigFileRequired()
+	s.config.ConfigSearchFallbacks()
+	files, _, err = s.config.findConfigFiles()
+	c.Assert(files, IsNil)
+	c.Assert(err, NotNil)
+}
+
+func (s *FindConfigFileSuite) TestConfigDir(c *C) {
+	dir := c.MkDir()
+	for name, contents := range map[string]string{
+		"20-b.conf": "B",
+		"10-a.conf": "A",
+		"README":    "IGNORED",
+	} {
+		path := filepath.Join(dir, name)
+		c.Assert(ioutil.WriteFile(path, []byte(contents), 0666), IsNil)
+	}
+	c.Assert(os.Mkdir(filepath.Join(dir, "30-dir.conf"), 0777), IsNil)
+
+	s.config.ConfigFile(s.defaultTestFileName)
+	s.config.ConfigDir(dir, "*.conf")
+	s.config.ConfigDir(filepath.Join(dir, "missing"), "*.conf")
+	s.config.Args([]string{})
+	files, _, err := s.config.findConfigFiles()
+	c.Assert(err, IsNil)
+	c.Assert(files[1].source, Equals, "config file "+filepath.Join(dir, "10-a.conf"))
+	assertFileContents(c, files, "DEFAULT_FILE", "A", "B")
+
+	s.config.ConfigFileShortFlag('c')
+	s.config.Args([]string{"-c", s.extraTestFileName})
+	files, _, err = s.config.findConfigFiles()
 	c.Assert(err, IsNil)
-	c.Assert(string(bytes), Equals, expected)
-	if closer, ok := fin.(io.Closer); ok {
-		closer.Close()
+	assertFileContents(c, files, "EXTRA_FILE", "A", "B")
+
+	c.Assert(
+		func() { s.config.ConfigDir(dir, "[") },
+		PanicMatches,
+		`conflag: Invalid config file pattern \[\.`,
+	)
+}
+
+func (s *FindConfigFileSuite) TestConfigDirOverrides(c *C) {
+	dir := c.MkDir()
+	main := filepath.Join(dir, "main.conf")
+	fragments := filepath.Join(dir, "conf.d")
+	for path, contents := range map[string]string{
+		main:                                     "port = 80\nname = main",
+		filepath.Join(fragments, "10-port.conf"): "port = 8080",
+		filepath.Join(fragments, "20-port.conf"): "port = 9090",
+	} {
+		c.Assert(os.MkdirAll(filepath.Dir(path), 0777), IsNil)
+		c.Assert(ioutil.WriteFile(path, []byte(contents), 0666), IsNil)
 	}
+
+	dest := &struct {
+		Port int
+		Name string
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.ConfigFile(main).ConfigDir(fragments, "*.conf")
+	_, err = config.Args([]string{}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Port, Equals, 9090)
+	c.Assert(dest.Name, Equals, "main")
+
+	// Fragments merge over the main config file whatever order they're
+	// added in, and over files named on the command line
+	dest.Port = 0
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	config.ConfigDir(fragments, "*.conf").ConfigFile(main)
+	_, err = config.Args([]string{}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Port, Equals, 9090)
+
+	dest.Port = 0
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	config.ConfigFileShortFlag('c').ConfigDir(fragments, "*.conf")
+	_, err = config.Args([]string{"-c", main}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Port, Equals, 9090)
 }
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Reads a config file holding a single JSON object, in which each key
+// is a file key and each nested object a category
+func readJSONConfigFile(
+	dest map[string]*Field,
+	src io.Reader,
+	source string,
+) error {
+	data, err := ioutil.ReadAll(src)
+	if closer, ok := src.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("conflag: Couldn't read %s: %s.", source, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return jsonSyntaxError(data, source, err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf(
+			"conflag: Unexpected data after the JSON object in %s.",
+			source,
+		)
+	}
+
+	object, ok := convertJSONValue(document).(map[string]interface{})
+	if !ok {
+		return fmt.Errorf(
+			"conflag: Expected a JSON object at the top level of %s.",
+			source,
+		)
+	}
+	reader := newStructuredReader(dest, source, "an object")
+	return reader.readObject("", "", object)
+}
+
+// Converts the numbers in a decoded JSON value to configNumbers
+func convertJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, element := range v {
+			v[key] = convertJSONValue(element)
+		}
+	case []interface{}:
+		for i, element := range v {
+			v[i] = convertJSONValue(element)
+		}
+	case json.Number:
+		return configNumber(v)
+	}
+	return value
+}
+
+// Describes a JSON decoding error, with the line it was found on if
+// the decoder reports an offset
+func jsonSyntaxError(data []byte, source string, err error) error {
+	offset := int64(-1)
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		offset = int64(len(data))
+		err = io.ErrUnexpectedEOF
+	}
+	if offset < 0 {
+		return fmt.Errorf("conflag: Invalid JSON in %s: %s.", source, err)
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line := bytes.Count(data[:offset], []byte("\n")) + 1
+	return fmt.Errorf(
+		"conflag: Invalid JSON on line %d of %s: %s.",
+		line,
+		source,
+		err,
+	)
+}
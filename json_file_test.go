@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type JSONFileSuite struct{}
+
+func TestJSONFile(t *testing.T) {
+	Suite(&JSONFileSuite{})
+	TestingT(t)
+}
+
+type jsonTestConfig struct {
+	Port     int
+	Ratio    float64
+	Name     string
+	Verbose  bool
+	Peers    []string
+	Ports    []uint16
+	Labels   map[string]string
+	Database struct {
+		Host    string
+		Timeout string
+		Pool    struct {
+			Size uint
+		}
+	}
+}
+
+func (s *JSONFileSuite) TestRead(c *C) {
+	dest := &jsonTestConfig{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+
+	file := `{
+		"port": 8080,
+		"ratio": 1.5e-1,
+		"name": "server",
+		"verbose": true,
+		"peers": ["a", "b, c"],
+		"ports": [80, 443],
+		"labels": {"env": "prod", "team": "core"},
+		"database": {
+			"host": "db.local",
+			"timeout": null,
+			"pool": {"size": 4}
+		}
+	}`
+	err = readJSONConfigFile(
+		config.fields,
+		strings.NewReader(file),
+		configFileSource,
+	)
+	c.Assert(err, IsNil)
+
+	c.Assert(config.fields["Port"].parsedValue, Equals, "8080")
+	c.Assert(config.fields["Ratio"].parsedValue, Equals, "1.5e-1")
+	c.Assert(config.fields["Name"].parsedValue, Equals, "server")
+	c.Assert(config.fields["Verbose"].parsedValue, Equals, "true")
+	c.Assert(
+		config.fields["Peers"].parsedValues,
+		DeepEquals,
+		[]string{`"a"`, `"b, c"`},
+	)
+	c.Assert(
+		config.fields["Labels"].parsedValues,
+		DeepEquals,
+		[]string{`"env=prod"`, `"team=core"`},
+	)
+	c.Assert(config.fields["Database.Host"].parsedValue, Equals, "db.local")
+	c.Assert(config.fields["Database.Timeout"].found, Equals, false)
+	c.Assert(config.fields["Database.Pool.Size"].parsedValue, Equals, "4")
+}
+
+func (s *JSONFileSuite) TestTypeErrors(c *C) {
+	cases := map[string]string{
+		`{"port": "80"}`: "conflag: Expected an integer, got a string " +
+			"at port in config file.",
+		`{"port": 8.5}`: "conflag: Expected an integer, got a number " +
+			"at port in config file.",
+		`{"name": 5}`: "conflag: Expected a string, got a number " +
+			"at name in config file.",
+		`{"verbose": "yes"}`: "conflag: Expected a boolean, got a string " +
+			"at verbose in config file.",
+		`{"ports": [80, "http"]}`: "conflag: Expected an integer, " +
+			"got a string at ports[1] in config file.",
+		`{"labels": {"env": ["a"]}}`: "conflag: Expected a string, " +
+			"got an array at labels.env in config file.",
+		`{"database": {"port": 5432}}`: "conflag: Invalid configuration " +
+			"file key at database.port in config file.",
+		`{"database": {"pool": []}}`: "conflag: Expected an object, " +
+			"got an array at database.pool in config file.",
+	}
+	for file, expected := range cases {
+		config, err := New(&jsonTestConfig{})
+		c.Assert(err, IsNil)
+		err = readJSONConfigFile(
+			config.fields,
+			strings.NewReader(file),
+			configFileSource,
+		)
+		c.Assert(err, NotNil, Commentf("%s", file))
+		c.Assert(err.Error(), Equals, expected)
+	}
+}
+
+func (s *JSONFileSuite) TestSyntaxErrors(c *C) {
+	cases := map[string]string{
+		"{\n  \"port\": 80,\n}": "conflag: Invalid JSON on line 3 of " +
+			"config file: invalid character '}' looking for " +
+			"beginning of object key string.",
+		"{\"port\": 80": "conflag: Invalid JSON on line 1 of " +
+			"config file: unexpected EOF.",
+		"[1, 2]": "conflag: Expected a JSON object at the top level " +
+			"of config file.",
+		"{} {}": "conflag: Unexpected data after the JSON object in " +
+			"config file.",
+	}
+	for file, expected := range cases {
+		config, err := New(&jsonTestConfig{})
+		c.Assert(err, IsNil)
+		err = readJSONConfigFile(
+			config.fields,
+			strings.NewReader(file),
+			configFileSource,
+		)
+		c.Assert(err, NotNil, Commentf("%s", file))
+		c.Assert(err.Error(), Equals, expected)
+	}
+}
+
+func (s *JSONFileSuite) TestFileFormat(c *C) {
+	dir := c.MkDir()
+	withExtension := filepath.Join(dir, "config.json")
+	plain := filepath.Join(dir, "config")
+	c.Assert(
+		ioutil.WriteFile(withExtension, []byte(`{"port": 80, "name": "a"}`), 0666),
+		IsNil,
+	)
+	c.Assert(ioutil.WriteFile(plain, []byte(`{"port": 8080}`), 0666), IsNil)
+
+	dest := &jsonTestConfig{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.ConfigFile(withExtension).ConfigFile(plain).ConfigFormat(JSONFormat)
+	_, err = config.Args([]string{}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Port, Equals, 8080)
+	c.Assert(dest.Name, Equals, "a")
+
+	config, err = New(&jsonTestConfig{})
+	c.Assert(err, IsNil)
+	config.ConfigFile(plain)
+	_, err = config.Args([]string{}).Read()
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// HostPort is a network address written as host:port, e.g.
+// db.example.com:5432, [::1]:8080 or :8080.  Unlike netip.AddrPort,
+// the host may be a name rather than an IP address, and it may be left
+// empty to mean every local address.
+type HostPort struct {
+	Host string
+	Port uint16
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (h *HostPort) UnmarshalText(text []byte) error {
+	host, port, err := net.SplitHostPort(string(text))
+	if err != nil {
+		return errors.New("expected host:port")
+	}
+	number, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %s", port)
+	}
+	h.Host, h.Port = host, uint16(number)
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (h HostPort) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// String joins the host and port, bracketing IPv6 addresses.
+func (h HostPort) String() string {
+	return net.JoinHostPort(h.Host, strconv.Itoa(int(h.Port)))
+}
+
+func init() {
+	networkDecoders := map[reflect.Type]DecodeFunc{
+		reflect.TypeOf(net.IP{}):         decodeIP,
+		reflect.TypeOf(netip.Addr{}):     decodeAddr,
+		reflect.TypeOf(netip.Prefix{}):   decodePrefix,
+		reflect.TypeOf(netip.AddrPort{}): decodeAddrPort,
+		reflect.TypeOf(url.URL{}):        decodeURLValue,
+		reflect.TypeOf(&url.URL{}):       decodeURL,
+	}
+	for t, decode := range networkDecoders {
+		defaultDecoders[t] = decoder{textFieldType, decode}
+	}
+}
+
+func decodeIP(value string) (interface{}, error) {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, errors.New("expected an IP address")
+	}
+	return ip, nil
+}
+
+func decodeAddr(value string) (interface{}, error) {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return nil, errors.New("expected an IP address")
+	}
+	return addr, nil
+}
+
+func decodePrefix(value string) (interface{}, error) {
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return nil, errors.New("expected a network prefix, e.g. 10.0.0.0/8")
+	}
+	return prefix, nil
+}
+
+func decodeAddrPort(value string) (interface{}, error) {
+	addrPort, err := netip.ParseAddrPort(value)
+	if err != nil {
+		return nil, errors.New("expected an IP address and port")
+	}
+	return addrPort, nil
+}
+
+// URLs must be absolute, since a relative URL is almost always a
+// mistake in configuration and url.Parse accepts nearly anything
+// as one
+func decodeURL(value string) (interface{}, error) {
+	result, err := url.Parse(value)
+	if err != nil || !result.IsAbs() {
+		return nil, errors.New("expected an absolute URL")
+	}
+	return result, nil
+}
+
+func decodeURLValue(value string) (interface{}, error) {
+	result, err := decodeURL(value)
+	if err != nil {
+		return nil, err
+	}
+	return *result.(*url.URL), nil
+}
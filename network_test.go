@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	. "gopkg.in/check.v1"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type NetworkSuite struct{}
+
+func TestNetwork(t *testing.T) {
+	Suite(&NetworkSuite{})
+	TestingT(t)
+}
+
+func (s *NetworkSuite) TestHostPort(c *C) {
+	cases := []struct {
+		value    string
+		expected HostPort
+		valid    bool
+	}{
+		{"db.example.com:5432", HostPort{"db.example.com", 5432}, true},
+		{"[::1]:8080", HostPort{"::1", 8080}, true},
+		{":8080", HostPort{"", 8080}, true},
+		{"db.example.com", HostPort{}, false},
+		{"db.example.com:http", HostPort{}, false},
+		{"db.example.com:65536", HostPort{}, false},
+	}
+	for _, test := range cases {
+		var result HostPort
+		err := result.UnmarshalText([]byte(test.value))
+		if !test.valid {
+			c.Assert(err, NotNil, Commentf("value %s", test.value))
+			continue
+		}
+		c.Assert(err, IsNil, Commentf("value %s", test.value))
+		c.Assert(result, Equals, test.expected)
+		c.Assert(result.String(), Equals, test.value)
+	}
+}
+
+func (s *NetworkSuite) TestNetworkFields(c *C) {
+	dest := &struct {
+		Bind    net.IP
+		Peer    netip.Addr
+		Allow   []netip.Prefix
+		Listen  netip.AddrPort
+		Backend HostPort
+		Proxy   *url.URL
+		Mirrors []*url.URL
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+
+	config.ConfigReader(
+		strings.NewReader(
+			"bind = 10.0.0.1\n" +
+				"listen = [::1]:8080\n" +
+				"proxy = http://proxy.example.com:3128\n",
+		),
+	)
+	config.Args(
+		[]string{
+			"--peer", "fe80::1",
+			"--allow", "10.0.0.0/8,192.168.0.0/16",
+			"--backend", "db.example.com:5432",
+			"--mirrors", "https://a.example.com,https://b.example.com",
+		},
+	)
+	_, err = config.Read()
+	c.Assert(err, IsNil)
+
+	c.Assert(dest.Bind.String(), Equals, "10.0.0.1")
+	c.Assert(dest.Peer, Equals, netip.MustParseAddr("fe80::1"))
+	c.Assert(
+		dest.Allow,
+		DeepEquals,
+		[]netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("192.168.0.0/16"),
+		},
+	)
+	c.Assert(dest.Listen, Equals, netip.MustParseAddrPort("[::1]:8080"))
+	c.Assert(dest.Backend, Equals, HostPort{"db.example.com", 5432})
+	c.Assert(dest.Proxy.String(), Equals, "http://proxy.example.com:3128")
+	c.Assert(dest.Mirrors, HasLen, 2)
+	c.Assert(dest.Mirrors[1].Host, Equals, "b.example.com")
+}
+
+func (s *NetworkSuite) TestNetworkFieldFailures(c *C) {
+	dest := &struct {
+		Bind   net.IP
+		Allow  []netip.Prefix
+		Listen netip.AddrPort
+		Proxy  *url.URL
+	}{}
+
+	for input, message := range map[string]string{
+		"bind = 10.0.0.256": "conflag: Invalid value for Bind from config " +
+			"file: Couldn't parse 10.0.0.256: expected an IP address.",
+		"allow = 10.0.0.0/8, 10.0.0.0/33": "conflag: Element 2 of Allow " +
+			"from config file: Couldn't parse 10.0.0.0/33: expected a " +
+			"network prefix, e.g. 10.0.0.0/8.",
+		"listen = localhost:80": "conflag: Invalid value for Listen from " +
+			"config file: Couldn't parse localhost:80: expected an IP " +
+			"address and port.",
+		"proxy = proxy.example.com": "conflag: Invalid value for Proxy " +
+			"from config file: Couldn't parse proxy.example.com: expected " +
+			"an absolute URL.",
+	} {
+		config, err := New(dest)
+		c.Assert(err, IsNil)
+		config.ConfigReader(strings.NewReader(input))
+		_, err = config.Args([]string{}).Read()
+		c.Assert(err, NotNil, Commentf("input %s", input))
+		c.Assert(err.Error(), Equals, message)
+	}
+
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	_, err = config.Args([]string{"--proxy", "http://[::1"}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Invalid value for Proxy from the command line: "+
+			"Couldn't parse http://[::1: expected an absolute URL.",
+	)
+	c.Assert(dest.Proxy, IsNil)
+}
+
+func (s *NetworkSuite) TestNetworkDefaults(c *C) {
+	proxy, _ := url.Parse("http://proxy.example.com")
+	dest := &struct {
+		Backend HostPort
+		Proxy   *url.URL
+		Origin  url.URL
+		Bind    net.IP
+	}{
+		Backend: HostPort{"localhost", 5432},
+		Proxy:   proxy,
+		Origin:  url.URL{Scheme: "https", Host: "x.y", Path: "/z"},
+		Bind:    net.ParseIP("::1"),
+	}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	c.Assert(
+		config.Field("Backend").usageDescription(),
+		Equals,
+		"(default localhost:5432)",
+	)
+	c.Assert(
+		config.Field("Proxy").usageDescription(),
+		Equals,
+		"(default http://proxy.example.com)",
+	)
+	c.Assert(
+		config.Field("Origin").usageDescription(),
+		Equals,
+		"(default https://x.y/z)",
+	)
+	c.Assert(config.Field("Bind").usageDescription(), Equals, "(default ::1)")
+}
@@ -35,7 +35,10 @@ package conflag
 import (
 	"errors"
 	"fmt"
-	"strconv"
+	"math"
+	"reflect"
+	"strings"
+	"unicode"
 )
 
 // Read reads configuration from the available sources into the
@@ -44,21 +47,31 @@ import (
 // not explicitly allowed via AllowExtraArgs) and an error which will
 // be nil if the configuration was processed successfully.
 func (c *Config) Read() ([]string, error) {
-	fin, args, err := c.findConfigFile()
+	// Values found by an earlier Read are found afresh
+	for _, field := range c.fields {
+		field.found, field.source = false, ""
+		field.parsedValue, field.parsedValues = "", nil
+	}
+
+	files, args, err := c.findConfigFiles()
 	if err != nil {
 		return nil, err
 	}
-	if fin == nil && c.fileRequired {
-		return nil, errors.New("conflag: Required config file not found.")
-	}
-
-	if fin != nil {
-		err = readConfigFile(c.fields, fin)
+	for i, file := range files {
+		err = readConfigFileFormat(
+			file.format,
+			c.fields,
+			file.reader,
+			file.source,
+		)
 		if err != nil {
+			closeConfigFiles(files[i+1:])
 			return nil, err
 		}
 	}
 
+	readEnvironment(c.envVarNames(), c.env)
+
 	extraArgs, err := readCommandLineFlags(c.fields, args, c.extraArgsAllowed)
 	if err != nil {
 		return nil, err
@@ -87,43 +100,294 @@ func (f *Field) readValue() error {
 		return nil
 	}
 
-	switch f.kind {
-	case boolFieldType:
-		val := false
-		if f.parsedValue == "true" {
-			val = true
+	if len(f.parsedValues) > 0 {
+		err := f.assignValues(f.source, f.parsedValues)
+		if err != nil {
+			return err
+		}
+	} else if f.counted {
+		f.destination.Set(f.defaultValue)
+	}
+	if f.counted {
+		return f.applyCount()
+	}
+	return nil
+}
+
+// Adds the number of times a counter field's flags were given on the
+// command line to the value it would otherwise hold
+func (f *Field) applyCount() error {
+	if f.kind == uintFieldType {
+		value := f.destination.Uint()
+		if f.count < 0 && uint64(-f.count) > value {
+			f.destination.SetUint(0)
+			return nil
+		}
+		if f.count > 0 && value > math.MaxUint64-uint64(f.count) ||
+			f.destination.OverflowUint(value+uint64(f.count)) {
+			return f.countOutOfRange(value)
+		}
+		f.destination.SetUint(value + uint64(f.count))
+		return nil
+	}
+
+	value := f.destination.Int()
+	if f.count > 0 && value > math.MaxInt64-int64(f.count) ||
+		f.count < 0 && value < math.MinInt64-int64(f.count) ||
+		f.destination.OverflowInt(value+int64(f.count)) {
+		return f.countOutOfRange(value)
+	}
+	f.destination.SetInt(value + int64(f.count))
+	return nil
+}
+
+func (f *Field) countOutOfRange(base interface{}) error {
+	return fmt.Errorf(
+		"conflag: Invalid value for %s: Count %d is out of range starting at %v.",
+		f.describe(commandLineSource),
+		f.count,
+		base,
+	)
+}
+
+// Names the field and, if known, the source of its value for error
+// messages, e.g. "Port from the command line"
+func (f *Field) describe(source string) string {
+	if source == "" {
+		return f.name
+	}
+	return f.name + " from " + source
+}
+
+// Decodes raw values read from source for the field and stores the
+// result in the destination.  Fields other than slices and maps only
+// use the last value.
+func (f *Field) assignValues(source string, values []string) error {
+	if f.kind == sliceFieldType {
+		return f.readSliceValue(source, values)
+	}
+	if f.kind == mapFieldType {
+		return f.readMapValue(source, values)
+	}
+
+	value := values[len(values)-1]
+	err := f.checkChoice(value)
+	if err == nil {
+		if f.pointer {
+			err = f.readPointerValue(value)
+		} else {
+			err = f.decode(f.destination, value)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf(
+			"conflag: Invalid value for %s: %s.",
+			f.describe(source),
+			err,
+		)
+	}
+	return nil
+}
+
+// Points the destination at a newly allocated value, leaving it
+// untouched if the value fails to decode
+func (f *Field) readPointerValue(raw string) error {
+	value := reflect.New(f.valueType())
+	err := f.decode(value.Elem(), raw)
+	if err != nil {
+		return err
+	}
+	f.destination.Set(value)
+	return nil
+}
+
+// Decodes a single raw value, or a single element or map value for
+// slice and map fields, into dest
+func (f *Field) decode(dest reflect.Value, value string) error {
+	if f.usesTimeLayout(dest.Type()) {
+		return f.decodeTimeLayout(dest, value)
+	}
+	converted, err := applyUnits(value, f.units)
+	if err != nil {
+		return fmt.Errorf("Couldn't parse %s: %s", value, err)
+	}
+	err = f.decoders.decode(dest, converted)
+	if err != nil && converted != value {
+		return fmt.Errorf("%s (from %s)", err, value)
+	}
+	return err
+}
+
+// Splits every raw value found for a slice or map field into its
+// elements
+func (f *Field) listElements(
+	source string,
+	values []string,
+) ([]string, error) {
+	elements := []string{}
+	for _, value := range values {
+		split, err := splitList(value, f.separator)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"conflag: Invalid list for %s: %s.",
+				f.describe(source),
+				err,
+			)
+		}
+		elements = append(elements, split...)
+	}
+	return elements, nil
+}
+
+// Replaces the destination slice or array with the elements found
+// for it.  Arrays must be given exactly as many elements as they hold.
+func (f *Field) readSliceValue(source string, values []string) error {
+	elements, err := f.listElements(source, values)
+	if err != nil {
+		return err
+	}
+
+	var slice reflect.Value
+	if f.destination.Kind() == reflect.Array {
+		if len(elements) != f.destination.Len() {
+			return fmt.Errorf(
+				"conflag: Invalid value for %s: Expected %d elements, got %d.",
+				f.describe(source),
+				f.destination.Len(),
+				len(elements),
+			)
+		}
+		slice = reflect.New(f.destination.Type()).Elem()
+	} else {
+		slice = reflect.MakeSlice(f.destination.Type(), len(elements), len(elements))
+	}
+	for i, element := range elements {
+		err := f.checkChoice(element)
+		if err == nil {
+			err = f.decode(slice.Index(i), element)
 		}
-		f.destination.SetBool(val)
-	case intFieldType:
-		val, err := strconv.ParseInt(f.parsedValue, 10, 64)
 		if err != nil {
 			return fmt.Errorf(
-				"conflag: Couldn't parse %s as integer.",
-				f.parsedValue,
+				"conflag: Element %d of %s: %s.",
+				i+1,
+				f.describe(source),
+				err,
 			)
 		}
-		f.destination.SetInt(val)
-	case uintFieldType:
-		val, err := strconv.ParseUint(f.parsedValue, 10, 64)
+	}
+	f.destination.Set(slice)
+	return nil
+}
+
+// Replaces the destination map with the key=value entries found for
+// it
+func (f *Field) readMapValue(source string, values []string) error {
+	elements, err := f.listElements(source, values)
+	if err != nil {
+		return err
+	}
+
+	mapType := f.destination.Type()
+	result := reflect.MakeMapWithSize(mapType, len(elements))
+	for i, element := range elements {
+		parts := strings.SplitN(element, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf(
+				"conflag: Entry %d of %s: Expected key=value, got %s.",
+				i+1,
+				f.describe(source),
+				element,
+			)
+		}
+
+		key := reflect.New(mapType.Key()).Elem()
+		err := f.decoders.decode(key, strings.TrimSpace(parts[0]))
 		if err != nil {
 			return fmt.Errorf(
-				"conflag: Couldn't parse %s as unsigned integer.",
-				f.parsedValue,
+				"conflag: Key of entry %d of %s: %s.",
+				i+1,
+				f.describe(source),
+				err,
 			)
 		}
-		f.destination.SetUint(val)
-	case floatFieldType:
-		val, err := strconv.ParseFloat(f.parsedValue, 64)
+		value := reflect.New(mapType.Elem()).Elem()
+		err = f.checkChoice(strings.TrimSpace(parts[1]))
+		if err == nil {
+			err = f.decode(value, strings.TrimSpace(parts[1]))
+		}
 		if err != nil {
 			return fmt.Errorf(
-				"conflag: Couldn't parse %s as floating point number.",
-				f.parsedValue,
+				"conflag: Value of entry %d of %s: %s.",
+				i+1,
+				f.describe(source),
+				err,
 			)
 		}
-		f.destination.SetFloat(val)
-	case stringFieldType:
-		f.destination.SetString(f.parsedValue)
+		result.SetMapIndex(key, value)
 	}
-
+	f.destination.Set(result)
 	return nil
 }
+
+// Splits a list value on separator.  Unquoted elements have
+// surrounding whitespace trimmed, while elements wrapped in double
+// quotes are kept verbatim and may contain the separator or escaped
+// quotes (\").  An empty value is an empty list.
+func splitList(value string, separator rune) ([]string, error) {
+	elements := []string{}
+	if strings.TrimSpace(value) == "" {
+		return elements, nil
+	}
+
+	current := []rune{}
+	quoted := false
+	wasQuoted := false
+	escaped := false
+	for _, r := range value {
+		switch {
+		case escaped:
+			current = append(current, r)
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"':
+			if !quoted && strings.TrimSpace(string(current)) != "" {
+				return nil, errors.New("Unexpected quote inside element")
+			}
+			if !quoted {
+				current = []rune{}
+			}
+			quoted = !quoted
+			wasQuoted = true
+		case quoted:
+			current = append(current, r)
+		case r == separator:
+			elements = append(elements, finishElement(current, wasQuoted))
+			current = []rune{}
+			wasQuoted = false
+		case wasQuoted:
+			if !unicode.IsSpace(r) {
+				return nil, errors.New("Unexpected text after quoted element")
+			}
+		default:
+			current = append(current, r)
+		}
+	}
+	if quoted {
+		return nil, errors.New("Unterminated quote")
+	}
+	return append(elements, finishElement(current, wasQuoted)), nil
+}
+
+// Quotes value so that splitList returns it as a single element
+func quoteListElement(value string) string {
+	escaped := strings.Replace(value, `\`, `\\`, -1)
+	return `"` + strings.Replace(escaped, `"`, `\"`, -1) + `"`
+}
+
+func finishElement(element []rune, wasQuoted bool) string {
+	if wasQuoted {
+		return string(element)
+	}
+	return strings.TrimSpace(string(element))
+}
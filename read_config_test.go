@@ -34,8 +34,11 @@ package conflag
 
 import (
 	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Most every component being used in the Read() method already has
@@ -159,6 +162,68 @@ func (s *ReadConfigSuite) TestRequiredFileFailure(c *C) {
 	c.Assert(err, NotNil)
 }
 
+func (s *ReadConfigSuite) TestLayeredConfigFiles(c *C) {
+	dir := c.MkDir()
+	system := filepath.Join(dir, "system.conf")
+	user := filepath.Join(dir, "user.conf")
+	for name, contents := range map[string]string{
+		system: "port = 80\npeers = a, b\nname = sys",
+		user:   "port = 8080\npeers = c",
+	} {
+		c.Assert(ioutil.WriteFile(name, []byte(contents), 0666), IsNil)
+	}
+
+	dest := &struct {
+		Port  int
+		Peers []string
+		Name  string
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.ConfigFile(system).
+		ConfigFile(filepath.Join(dir, "missing.conf")).
+		ConfigFile(user)
+	_, err = config.Args([]string{}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Port, Equals, 8080)
+	c.Assert(dest.Peers, DeepEquals, []string{"c"})
+	c.Assert(dest.Name, Equals, "sys")
+
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	config.ConfigFileShortFlag('c').ConfigFile(system)
+	_, err = config.Args([]string{"-c", user, "-c", system}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Port, Equals, 80)
+	c.Assert(dest.Peers, DeepEquals, []string{"a", "b"})
+
+	bad := filepath.Join(dir, "bad.conf")
+	c.Assert(ioutil.WriteFile(bad, []byte("port = http"), 0666), IsNil)
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	config.ConfigReader(strings.NewReader("port = 80")).ConfigFile(bad)
+	_, err = config.Args([]string{}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Invalid value for Port from config file "+bad+
+			": Couldn't parse http as integer.",
+	)
+
+	c.Assert(ioutil.WriteFile(bad, []byte("prot = 80"), 0666), IsNil)
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	config.ConfigReader(strings.NewReader("port = 80")).ConfigFile(bad)
+	_, err = config.Args([]string{}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Invalid configuration file key: prot (in "+bad+").",
+	)
+}
+
 func (s *ReadConfigSuite) TestRequiredFieldFailure(c *C) {
 	s.config.Args([]string{}).
 		Field("IntField").
@@ -191,3 +256,316 @@ func (s *ReadConfigSuite) TestFloatParseFailure(c *C) {
 	c.Assert(extraArgs, IsNil)
 	c.Assert(err, NotNil)
 }
+
+func (s *ReadConfigSuite) TestSliceFields(c *C) {
+	dest := &struct {
+		Peers []string
+		Ports []int
+		Flags []bool
+	}{Peers: []string{"default"}}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.Field("Ports").ShortFlag('p').Separator(':')
+
+	file := `
+		peers = a, "b,c"
+		peers = d
+		ports = 1`
+	config.ConfigReader(strings.NewReader(file))
+	config.Args([]string{"-p", "80:443", "-p", "8080", "--flags", "true,false"})
+
+	_, err = config.Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Peers, DeepEquals, []string{"a", "b,c", "d"})
+	c.Assert(dest.Ports, DeepEquals, []int{80, 443, 8080})
+	c.Assert(dest.Flags, DeepEquals, []bool{true, false})
+}
+
+func (s *ReadConfigSuite) TestRereadSliceFields(c *C) {
+	dest := &struct{ Peers []string }{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.Args([]string{"--peers", "a"})
+
+	for i := 0; i < 2; i++ {
+		_, err = config.Read()
+		c.Assert(err, IsNil)
+		c.Assert(dest.Peers, DeepEquals, []string{"a"})
+	}
+}
+
+func (s *ReadConfigSuite) TestSliceElementParseFailure(c *C) {
+	dest := &struct{ Ports []int }{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+
+	_, err = config.Args([]string{"--ports", "80,http"}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Element 2 of Ports from the command line: Couldn't "+
+			"parse http as integer.",
+	)
+}
+
+func (s *ReadConfigSuite) TestArrayFields(c *C) {
+	dest := &struct {
+		Color   [3]uint8
+		Weights [2]float64
+	}{Weights: [2]float64{0.5, 0.5}}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	c.Assert(config.Field("Weights").usageDescription(), Equals, "(default 0.5,0.5)")
+
+	config.ConfigReader(strings.NewReader("color = 255, 128, 0"))
+	_, err = config.Args([]string{"--weights", "0.25,0.75"}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Color, Equals, [3]uint8{255, 128, 0})
+	c.Assert(dest.Weights, Equals, [2]float64{0.25, 0.75})
+
+	for args, message := range map[string]string{
+		"--color 1,2": "conflag: Invalid value for Color from the command " +
+			"line: Expected 3 elements, got 2.",
+		"--weights 1,2,3": "conflag: Invalid value for Weights from the " +
+			"command line: Expected 2 elements, got 3.",
+		"--color 1,2,x": "conflag: Element 3 of Color from the command " +
+			"line: Couldn't parse x as unsigned integer.",
+		"--color 1,2,256": "conflag: Element 3 of Color from the command " +
+			"line: 256 is out of range for uint8.",
+	} {
+		config, err := New(dest)
+		c.Assert(err, IsNil)
+		_, err = config.Args(strings.Fields(args)).Read()
+		c.Assert(err, NotNil, Commentf("args %s", args))
+		c.Assert(err.Error(), Equals, message)
+	}
+	c.Assert(dest.Color, Equals, [3]uint8{255, 128, 0})
+}
+
+func (s *ReadConfigSuite) TestSplitList(c *C) {
+	elements, err := splitList(` a , "b, \"c\"" ,,d `, ',')
+	c.Assert(err, IsNil)
+	c.Assert(elements, DeepEquals, []string{"a", `b, "c"`, "", "d"})
+
+	elements, err = splitList("  ", ',')
+	c.Assert(err, IsNil)
+	c.Assert(elements, DeepEquals, []string{})
+
+	_, err = splitList(`"unterminated`, ',')
+	c.Assert(err, NotNil)
+	_, err = splitList(`"a"b`, ',')
+	c.Assert(err, NotNil)
+}
+
+func (s *ReadConfigSuite) TestMapFields(c *C) {
+	dest := &struct {
+		Labels  map[string]string
+		Weights map[string]float64
+		Enabled map[string]bool
+	}{Labels: map[string]string{"default": "x"}}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.Field("Labels").LongFlag("label")
+
+	file := `
+		[weights]
+		a = 0.5
+		b = 2
+
+		[enabled]
+		feature = true`
+	config.ConfigReader(strings.NewReader(file))
+	config.Args(
+		[]string{"--label", "env=prod", "--label", "team=infra,tier = web"},
+	)
+
+	_, err = config.Read()
+	c.Assert(err, IsNil)
+	c.Assert(
+		dest.Labels,
+		DeepEquals,
+		map[string]string{"env": "prod", "team": "infra", "tier": "web"},
+	)
+	c.Assert(dest.Weights, DeepEquals, map[string]float64{"a": 0.5, "b": 2})
+	c.Assert(dest.Enabled, DeepEquals, map[string]bool{"feature": true})
+}
+
+func (s *ReadConfigSuite) TestMapEntryFailures(c *C) {
+	dest := &struct{ Limits map[string]int }{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+
+	_, err = config.Args([]string{"--limits", "a=1,b"}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Entry 2 of Limits from the command line: Expected "+
+			"key=value, got b.",
+	)
+
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	_, err = config.Args([]string{"--limits", "a=lots"}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Value of entry 1 of Limits from the command line: "+
+			"Couldn't parse lots as integer.",
+	)
+}
+
+func (s *ReadConfigSuite) TestDurationFields(c *C) {
+	dest := &struct {
+		Timeout   time.Duration
+		Intervals []time.Duration
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	c.Assert(config.Field("Timeout").kind, Equals, durationFieldType)
+
+	config.ConfigReader(strings.NewReader("timeout = 1d12h"))
+	config.Args([]string{"--intervals", "30s,1m"})
+	_, err = config.Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Timeout, Equals, 36*time.Hour)
+	c.Assert(
+		dest.Intervals,
+		DeepEquals,
+		[]time.Duration{30 * time.Second, time.Minute},
+	)
+
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	_, err = config.Args([]string{"--timeout", "30"}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Invalid value for Timeout from the command line: "+
+			"Couldn't parse 30 as duration.",
+	)
+}
+
+func (s *ReadConfigSuite) TestSelfDecodingFields(c *C) {
+	dest := &struct {
+		Level  testLevel
+		Levels []testLevel
+		Pair   testPair
+		Switch testSwitch
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.Field("Switch").ShortFlag('s').InverseLongFlag("no-switch")
+
+	config.ConfigReader(strings.NewReader("level = debug\npair = x/y"))
+	config.Args([]string{"--levels", "info,error", "-s"})
+	_, err = config.Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Level, Equals, testLevel("debug"))
+	c.Assert(dest.Levels, DeepEquals, []testLevel{"info", "error"})
+	c.Assert(dest.Pair, Equals, testPair{A: "x", B: "y"})
+	c.Assert(dest.Switch.on, Equals, true)
+
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	_, err = config.Args([]string{"--level", "loud"}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Invalid value for Level from the command line: "+
+			"Couldn't parse loud: unknown level.",
+	)
+}
+
+func (s *ReadConfigSuite) TestPointerFields(c *C) {
+	dest := &struct {
+		Retries *int
+		Verbose *bool
+		Name    *string
+		Timeout *time.Duration
+		Unset   *int
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.Field("Verbose").ShortFlag('v')
+
+	config.ConfigReader(strings.NewReader("retries = 0\ntimeout = 1m"))
+	config.Args([]string{"-v", "--name", ""})
+	_, err = config.Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Retries, NotNil)
+	c.Assert(*dest.Retries, Equals, 0)
+	c.Assert(*dest.Verbose, Equals, true)
+	c.Assert(*dest.Name, Equals, "")
+	c.Assert(*dest.Timeout, Equals, time.Minute)
+	c.Assert(dest.Unset, IsNil)
+
+	dest.Retries = nil
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	_, err = config.Args([]string{"--retries", "many"}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(dest.Retries, IsNil)
+}
+
+func (s *ReadConfigSuite) TestDeeplyNestedFields(c *C) {
+	dest := &struct {
+		Database struct {
+			Name    string
+			Replica struct {
+				Host string
+				Port int
+			}
+		}
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+
+	file := `
+		[database]
+		name = app
+
+		[database.replica]
+		host = replica.local
+		port = 5432`
+	config.ConfigReader(strings.NewReader(file))
+	config.Args([]string{"--database.replica.host", "other.local"})
+
+	_, err = config.Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Database.Name, Equals, "app")
+	c.Assert(dest.Database.Replica.Host, Equals, "other.local")
+	c.Assert(dest.Database.Replica.Port, Equals, 5432)
+}
+
+func (s *ReadConfigSuite) TestEmbeddedAndReusedStructs(c *C) {
+	dest := &struct {
+		testCommonOptions
+		Primary testDBConfig
+		Replica testDBConfig
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+
+	file := `
+		verbose = true
+
+		[primary]
+		host = db1
+
+		[replica]
+		host = db2`
+	config.ConfigReader(strings.NewReader(file))
+	config.Args([]string{"--log-file", "app.log", "--replica.port", "5433"})
+
+	_, err = config.Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Verbose, Equals, true)
+	c.Assert(dest.LogFile, Equals, "app.log")
+	c.Assert(dest.Primary, Equals, testDBConfig{Host: "db1"})
+	c.Assert(dest.Replica, Equals, testDBConfig{Host: "db2", Port: 5433})
+}
@@ -0,0 +1,338 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A number read from a structured config file, kept as written so
+// that it's decoded for its field in the same way as any other value
+type configNumber string
+
+// Indicates whether the number is written as an integer
+func (n configNumber) isInteger() bool {
+	digits := strings.TrimLeft(string(n), "+-")
+	return len(digits) > 0 && strings.Trim(digits, "0123456789") == ""
+}
+
+// A scalar of a type that only some formats have, which checks for
+// itself whether it suits a field
+type formatSpecificScalar interface {
+	// Returns the scalar's text for a field, or a single element or
+	// map value of a slice or map field, with the given kind and type,
+	// or false if it doesn't suit it
+	fieldText(field *Field, kind fieldType, t reflect.Type) (string, bool)
+	// Names the scalar's type in error messages
+	typeName() string
+}
+
+// Reads the values parsed from a config file format with typed values,
+// such as JSON, into the fields they belong to.  Objects are held as
+// map[string]interface{} and arrays as []interface{}, with scalars
+// being strings, bools, configNumbers or format-specific scalars.
+// Nulls are skipped, as though the key were missing.
+type structuredReader struct {
+	source string
+	// What the format calls an object in error messages, e.g. "a
+	// table"
+	objectName  string
+	fields      map[string]*Field
+	mapSections map[string]*Field
+	// The line each value is found on by its path, if the format
+	// keeps track of them
+	lines map[string]int
+}
+
+func newStructuredReader(
+	dest map[string]*Field,
+	source string,
+	objectName string,
+) *structuredReader {
+	return &structuredReader{
+		source:      source,
+		objectName:  objectName,
+		fields:      buildConfigFileIndex(dest),
+		mapSections: buildMapSectionIndex(dest),
+		lines:       map[string]int{},
+	}
+}
+
+// Reads every key in an object, where category is the file category
+// the object represents and path the location of the object in the
+// file, both empty for the top level
+func (r *structuredReader) readObject(
+	category string,
+	path string,
+	object map[string]interface{},
+) error {
+	for _, key := range sortedKeys(object) {
+		value := object[key]
+		if value == nil {
+			continue
+		}
+		fullKey := joinPath(category, key)
+		valuePath := joinPath(path, key)
+
+		if field, ok := r.mapSections[fullKey]; ok {
+			if entries, ok := value.(map[string]interface{}); ok {
+				err := r.readMapEntries(field, valuePath, entries)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if field, ok := r.fields[fullKey]; ok {
+			err := r.readField(field, valuePath, value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			err := r.readObject(fullKey, valuePath, nested)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if r.isCategory(fullKey) {
+			return r.errorAt(
+				valuePath,
+				"Expected %s, got %s",
+				r.objectName,
+				r.describeValue(value),
+			)
+		}
+		return r.errorAt(valuePath, "Invalid configuration file key")
+	}
+	return nil
+}
+
+// Indicates whether a key names a file category, or a category that
+// holds others, rather than a field
+func (r *structuredReader) isCategory(key string) bool {
+	for fieldKey := range r.fields {
+		if strings.HasPrefix(fieldKey, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *structuredReader) readField(
+	field *Field,
+	path string,
+	value interface{},
+) error {
+	elements, ok := value.([]interface{})
+	if !ok || field.kind != sliceFieldType {
+		// A single scalar for a slice field is checked as one element,
+		// except that a string is split into a list as in INI files
+		kind := field.kind
+		if text, ok := value.(string); ok && kind == sliceFieldType {
+			field.setValue(r.source, text)
+			return nil
+		} else if kind == sliceFieldType {
+			kind = field.elemKind
+		}
+		text, err := r.scalarText(field, kind, field.scalarType(), path, value)
+		if err != nil {
+			return err
+		}
+		field.setValue(r.source, text)
+		return nil
+	}
+
+	// An empty array still replaces any earlier value
+	if len(elements) == 0 {
+		field.setValue(r.source, "")
+	}
+	for i, element := range elements {
+		text, err := r.scalarText(
+			field,
+			field.elemKind,
+			field.scalarType(),
+			fmt.Sprintf("%s[%d]", path, i),
+			element,
+		)
+		if err != nil {
+			return err
+		}
+		field.setValue(r.source, quoteListElement(text))
+	}
+	return nil
+}
+
+func (r *structuredReader) readMapEntries(
+	field *Field,
+	path string,
+	entries map[string]interface{},
+) error {
+	if len(entries) == 0 {
+		field.setValue(r.source, "")
+	}
+	for _, key := range sortedKeys(entries) {
+		text, err := r.scalarText(
+			field,
+			field.elemKind,
+			field.scalarType(),
+			joinPath(path, key),
+			entries[key],
+		)
+		if err != nil {
+			return err
+		}
+		field.setMapEntry(r.source, key, text)
+	}
+	return nil
+}
+
+// Checks that a scalar suits a field, or a single element or map value
+// of a slice or map field, with the given kind and type, and returns
+// its text to be decoded
+func (r *structuredReader) scalarText(
+	field *Field,
+	kind fieldType,
+	t reflect.Type,
+	path string,
+	value interface{},
+) (string, error) {
+	numeric := kind == intFieldType || kind == uintFieldType ||
+		kind == floatFieldType
+	expected := "a string"
+	switch {
+	case kind == boolFieldType:
+		expected = "a boolean"
+	case kind == intFieldType || kind == uintFieldType:
+		expected = "an integer"
+	case kind == floatFieldType:
+		expected = "a number"
+	}
+
+	switch v := value.(type) {
+	case formatSpecificScalar:
+		if text, ok := v.fieldText(field, kind, t); ok {
+			return text, nil
+		}
+	case string:
+		// Numbers with units can only be written as strings
+		if kind != boolFieldType && (!numeric || field.units != NoUnits) {
+			return v, nil
+		}
+	case bool:
+		if kind == boolFieldType ||
+			(kind == flagValueFieldType && field.isBoolean()) {
+			return strconv.FormatBool(v), nil
+		}
+	case configNumber:
+		if (kind == intFieldType || kind == uintFieldType) && !v.isInteger() {
+			return "", r.errorAt(path, "Expected an integer, got a number")
+		}
+		if kind != boolFieldType && kind != stringFieldType {
+			return string(v), nil
+		}
+	}
+	return "", r.errorAt(
+		path,
+		"Expected %s, got %s",
+		expected,
+		r.describeValue(value),
+	)
+}
+
+// Names the type of a value in error messages
+func (r *structuredReader) describeValue(value interface{}) string {
+	switch v := value.(type) {
+	case formatSpecificScalar:
+		return v.typeName()
+	case map[string]interface{}:
+		return r.objectName
+	case []interface{}:
+		return "an array"
+	case bool:
+		return "a boolean"
+	case configNumber:
+		return "a number"
+	}
+	return "a string"
+}
+
+// Builds an error for the value at a path, noting its line if known
+func (r *structuredReader) errorAt(
+	path string,
+	format string,
+	args ...interface{},
+) error {
+	location := path
+	if line, ok := r.lines[path]; ok {
+		location = fmt.Sprintf("%s (line %d)", path, line)
+	}
+	return fmt.Errorf(
+		"conflag: %s at %s in %s.",
+		fmt.Sprintf(format, args...),
+		location,
+		r.source,
+	)
+}
+
+// Finds the type of a field's values, or of its elements or map values
+// for slice and map fields
+func (f *Field) scalarType() reflect.Type {
+	t := f.valueType()
+	if f.kind == sliceFieldType || f.kind == mapFieldType {
+		return t.Elem()
+	}
+	return t
+}
+
+func joinPath(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
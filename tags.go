@@ -0,0 +1,285 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var tagUnits = map[string]Units{
+	"si":      SIUnits,
+	"bytes":   ByteUnits,
+	"percent": PercentUnits,
+}
+
+// A single option from a conflag struct tag, e.g. short=p
+type tagOption struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+// Splits a conflag struct tag into its comma-separated options.
+// Values containing commas may be wrapped in single quotes, within
+// which \' and \\ escape a quote and a backslash.
+func parseTag(tag string) ([]tagOption, error) {
+	options := []tagOption{}
+	rest := tag
+	for strings.TrimSpace(rest) != "" {
+		option := tagOption{}
+		end := strings.IndexAny(rest, ",=")
+		if end == -1 {
+			end = len(rest)
+		}
+		option.name = strings.TrimSpace(rest[:end])
+		if option.name == "" {
+			return nil, errors.New("empty option name")
+		}
+		rest = rest[end:]
+
+		if strings.HasPrefix(rest, "=") {
+			option.hasValue = true
+			value, remaining, err := parseTagValue(rest[1:])
+			if err != nil {
+				return nil, fmt.Errorf("option %s: %s", option.name, err)
+			}
+			option.value, rest = value, remaining
+		}
+
+		options = append(options, option)
+		if strings.HasPrefix(rest, ",") {
+			rest = rest[1:]
+			if strings.TrimSpace(rest) == "" {
+				return nil, errors.New("trailing comma")
+			}
+		}
+	}
+	return options, nil
+}
+
+// Reads a single option value from the start of a tag, returning it
+// along with the remainder of the tag
+func parseTagValue(tag string) (string, string, error) {
+	trimmed := strings.TrimLeft(tag, " ")
+	if !strings.HasPrefix(trimmed, "'") {
+		end := strings.Index(tag, ",")
+		if end == -1 {
+			end = len(tag)
+		}
+		return strings.TrimSpace(tag[:end]), tag[end:], nil
+	}
+
+	value := []rune{}
+	escaped := false
+	for i, r := range trimmed[1:] {
+		switch {
+		case escaped:
+			value = append(value, r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '\'':
+			remaining := strings.TrimLeft(trimmed[i+2:], " ")
+			if remaining != "" && remaining[0] != ',' {
+				return "", "", errors.New("unexpected text after quoted value")
+			}
+			return string(value), remaining, nil
+		default:
+			value = append(value, r)
+		}
+	}
+	return "", "", errors.New("unterminated quote")
+}
+
+// Applies the options in a field's conflag struct tag.  Each option
+// corresponds to one of the Field modifier methods:
+//
+//	long=NAME           LongFlag
+//	short=C             ShortFlag
+//	inverse=NAME        InverseLongFlag
+//	inverse-short=C     InverseShortFlag
+//	category=NAME       FileCategory
+//	key=NAME            FileKey
+//	env=NAME            EnvVar
+//	desc=TEXT           Description
+//	required            Required
+//	counter             Counter
+//	default=VALUE       Default
+//	sep=C               Separator
+//	choices=A|B|C       Choices
+//	units=UNITS         Units, one of si, bytes or percent
+//	layout=LAYOUT       TimeLayout
+func (f *Field) applyTag(tag string) (err error) {
+	options, err := parseTag(tag)
+	if err != nil {
+		return fmt.Errorf("conflag: Invalid tag on field %s: %s.", f.name, err)
+	}
+
+	// The modifier methods panic on invalid settings, which here
+	// should be reported as an error instead.  Any other panic is a
+	// bug, and is left alone.
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		message, ok := r.(error)
+		if !ok || !strings.HasPrefix(message.Error(), "conflag: ") {
+			panic(r)
+		}
+		// The field is already named, so it isn't repeated
+		text := strings.TrimPrefix(message.Error(), "conflag: ")
+		text = strings.TrimPrefix(text, "Invalid value for "+f.name+": ")
+		err = fmt.Errorf("conflag: Invalid tag on field %s: %s", f.name, text)
+	}()
+
+	// A counter must be set up before its inverse flags, and a default
+	// is checked against the field's choices, units and layout, so
+	// these are applied first and last whatever order they're given in
+	sort.SliceStable(options, func(i, j int) bool {
+		return tagOptionPhase(options[i].name) <
+			tagOptionPhase(options[j].name)
+	})
+
+	for _, option := range options {
+		if option.name == "required" || option.name == "counter" {
+			if option.hasValue {
+				return fmt.Errorf(
+					"conflag: Invalid tag on field %s: %s takes no value.",
+					f.name,
+					option.name,
+				)
+			}
+			if option.name == "required" {
+				f.Required()
+			} else {
+				f.Counter()
+			}
+			continue
+		}
+		if !option.hasValue {
+			return fmt.Errorf(
+				"conflag: Invalid tag on field %s: %s requires a value.",
+				f.name,
+				option.name,
+			)
+		}
+
+		switch option.name {
+		case "long":
+			f.LongFlag(option.value)
+		case "short", "inverse-short", "sep":
+			r, err := tagRune(option.value)
+			if err == nil && r == 0 && option.name == "sep" {
+				err = errors.New("must be a single character")
+			}
+			if err != nil {
+				return fmt.Errorf(
+					"conflag: Invalid tag on field %s: %s %s.",
+					f.name,
+					option.name,
+					err,
+				)
+			}
+			switch option.name {
+			case "short":
+				f.ShortFlag(r)
+			case "inverse-short":
+				f.InverseShortFlag(r)
+			case "sep":
+				f.Separator(r)
+			}
+		case "inverse":
+			f.InverseLongFlag(option.value)
+		case "category":
+			f.FileCategory(option.value)
+		case "key":
+			f.FileKey(option.value)
+		case "env":
+			f.EnvVar(option.value)
+		case "desc":
+			f.Description(option.value)
+		case "choices":
+			f.Choices(strings.Split(option.value, "|")...)
+		case "units":
+			units, ok := tagUnits[option.value]
+			if !ok {
+				return fmt.Errorf(
+					"conflag: Invalid tag on field %s: unknown units %s.",
+					f.name,
+					option.value,
+				)
+			}
+			f.Units(units)
+		case "layout":
+			f.TimeLayout(option.value)
+		case "default":
+			f.Default(option.value)
+		default:
+			return fmt.Errorf(
+				"conflag: Invalid tag on field %s: unknown option %s.",
+				f.name,
+				option.name,
+			)
+		}
+	}
+	return nil
+}
+
+// Orders the tag options that other options depend on
+func tagOptionPhase(name string) int {
+	switch name {
+	case "counter":
+		return 0
+	case "default":
+		return 2
+	}
+	return 1
+}
+
+// Reads a flag or separator character from a tag option, where an
+// empty value means none
+func tagRune(value string) (rune, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if utf8.RuneCountInString(value) != 1 {
+		return 0, errors.New("must be a single character")
+	}
+	r, _ := utf8.DecodeRuneInString(value)
+	return r, nil
+}
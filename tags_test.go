@@ -0,0 +1,219 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	. "gopkg.in/check.v1"
+	"reflect"
+	"testing"
+)
+
+type TagsSuite struct{}
+
+func TestTags(t *testing.T) {
+	Suite(&TagsSuite{})
+	TestingT(t)
+}
+
+func (s *TagsSuite) TestParseTag(c *C) {
+	options, err := parseTag(
+		`short=p, desc='Port to serve on, \'by number\'', required,long=`,
+	)
+	c.Assert(err, IsNil)
+	c.Assert(
+		options,
+		DeepEquals,
+		[]tagOption{
+			{name: "short", value: "p", hasValue: true},
+			{
+				name:     "desc",
+				value:    "Port to serve on, 'by number'",
+				hasValue: true,
+			},
+			{name: "required"},
+			{name: "long", value: "", hasValue: true},
+		},
+	)
+
+	for _, tag := range []string{
+		"short=p,",
+		",short=p",
+		"desc='unterminated",
+		"desc='quoted' trailing",
+	} {
+		_, err := parseTag(tag)
+		c.Assert(err, NotNil, Commentf("tag %s", tag))
+	}
+}
+
+func (s *TagsSuite) TestTaggedFields(c *C) {
+	dest := struct {
+		Port    int      `conflag:"short=p,long=port-number,desc='Port, by number',required"`
+		Verbose bool     `conflag:"short=v,inverse=quiet,inverse-short=q"`
+		Host    string   `conflag:"category=net,key=host_name,default=localhost"`
+		Peers   []string `conflag:"sep=;,long="`
+	}{}
+	config, err := New(&dest)
+	c.Assert(err, IsNil)
+
+	port := config.Field("Port")
+	c.Assert(port.shortFlag, Equals, 'p')
+	c.Assert(port.longFlag, Equals, "port-number")
+	c.Assert(port.description, Equals, "Port, by number")
+	c.Assert(port.required, Equals, true)
+
+	verbose := config.Field("Verbose")
+	c.Assert(verbose.shortFlag, Equals, 'v')
+	c.Assert(verbose.inverseLongFlag, Equals, "quiet")
+	c.Assert(verbose.inverseShortFlag, Equals, 'q')
+
+	host := config.Field("Host")
+	c.Assert(host.fileCategory, Equals, "net")
+	c.Assert(host.fileKey, Equals, "host_name")
+	c.Assert(dest.Host, Equals, "localhost")
+
+	peers := config.Field("Peers")
+	c.Assert(peers.separator, Equals, ';')
+	c.Assert(peers.longFlag, Equals, "")
+
+	// Modifier methods apply on top of the tags
+	port.ShortFlag('P')
+	c.Assert(port.shortFlag, Equals, 'P')
+}
+
+func (s *TagsSuite) TestOptionOrder(c *C) {
+	dest := struct {
+		Size    int    `conflag:"default=2k,units=si"`
+		Level   string `conflag:"default=info,choices=debug|info"`
+		Verbose int    `conflag:"inverse-short=q,counter"`
+	}{}
+	config, err := New(&dest)
+	c.Assert(err, IsNil)
+	c.Assert(dest.Size, Equals, 2000)
+	c.Assert(dest.Level, Equals, "info")
+	c.Assert(config.Field("Verbose").counter, Equals, true)
+	c.Assert(config.Field("Verbose").inverseShortFlag, Equals, 'q')
+
+	c.Assert(
+		newError(&struct {
+			A string `conflag:"default=loud,choices=debug|info"`
+		}{}),
+		Equals,
+		"conflag: Invalid tag on field A: loud isn't an allowed value; "+
+			"choose one of debug, info.",
+	)
+}
+
+func (s *TagsSuite) TestUnexpectedPanicsPropagate(c *C) {
+	dest := &struct {
+		Point testPoint `conflag:"default='1,2'"`
+	}{}
+	decoders := map[reflect.Type]DecodeFunc{
+		reflect.TypeOf(testPoint{}): func(value string) (interface{}, error) {
+			var point *testPoint
+			return *point, nil
+		},
+	}
+	c.Assert(
+		func() { NewWithDecoders(dest, decoders) },
+		PanicMatches,
+		".*nil pointer dereference.*",
+	)
+}
+
+func (s *TagsSuite) TestInvalidTagsFail(c *C) {
+	c.Assert(
+		newError(&struct {
+			A int `conflag:"colour=blue"`
+		}{}),
+		Equals,
+		"conflag: Invalid tag on field A: unknown option colour.",
+	)
+	c.Assert(
+		newError(&struct {
+			A int `conflag:"short=ab"`
+		}{}),
+		Equals,
+		"conflag: Invalid tag on field A: short must be a single character.",
+	)
+	c.Assert(
+		newError(&struct {
+			A int `conflag:"inverse=no-a"`
+		}{}),
+		Equals,
+		"conflag: Invalid tag on field A: Only boolean and counter fields may have inverse flags.",
+	)
+	c.Assert(
+		newError(&struct {
+			A int `conflag:"default=lots"`
+		}{}),
+		Equals,
+		"conflag: Invalid tag on field A: Couldn't parse lots as integer.",
+	)
+	c.Assert(
+		newError(&struct {
+			A int `conflag:"required=yes"`
+		}{}),
+		Equals,
+		"conflag: Invalid tag on field A: required takes no value.",
+	)
+	c.Assert(
+		newError(&struct {
+			A int `conflag:"key"`
+		}{}),
+		Equals,
+		"conflag: Invalid tag on field A: key requires a value.",
+	)
+	c.Assert(
+		newError(&struct {
+			A int `conflag:"key=a.b"`
+		}{}),
+		Equals,
+		"conflag: Invalid tag on field A: File key names cannot include '.'",
+	)
+	c.Assert(
+		newError(&struct {
+			A struct{ B int } `conflag:"category=a"`
+		}{}),
+		Equals,
+		`conflag: Struct field A may only be tagged with "-".`,
+	)
+}
+
+func newError(destination interface{}) string {
+	config, err := New(destination)
+	if config != nil || err == nil {
+		return ""
+	}
+	return err.Error()
+}
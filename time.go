@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+var locationType = reflect.TypeOf(&time.Location{})
+
+func init() {
+	defaultDecoders[timeType] = decoder{textFieldType, decodeTime}
+	defaultDecoders[locationType] = decoder{textFieldType, decodeLocation}
+}
+
+func decodeTime(value string) (interface{}, error) {
+	result, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errors.New("expected an RFC 3339 time")
+	}
+	return result, nil
+}
+
+// Time zones are loaded by IANA name, e.g. Europe/Berlin, along with
+// UTC and Local.  An empty name would mean UTC to time.LoadLocation,
+// but in configuration is more likely a mistake.
+func decodeLocation(value string) (interface{}, error) {
+	if value == "" {
+		return nil, errors.New("empty time zone name")
+	}
+	return time.LoadLocation(value)
+}
+
+// TimeLayout sets the layout, in the form accepted by time.Parse, used
+// to read and display a time.Time field, or the elements or map
+// values of a slice or map of them, in place of RFC 3339, e.g.
+// 2015-06-01T02:00:00Z.  Times without a zone in the layout are read
+// as UTC.  *time.Location fields are always written as IANA time zone
+// names, e.g. Europe/Berlin.  Panics for fields of any other type.
+func (f *Field) TimeLayout(layout string) *Field {
+	valueType := f.valueType()
+	if f.kind == sliceFieldType || f.kind == mapFieldType {
+		valueType = valueType.Elem()
+	}
+	if valueType != timeType {
+		panic(errors.New("conflag: Only time fields may have a time layout."))
+	}
+	if layout == "" {
+		panic(errors.New("conflag: Time layouts must not be empty."))
+	}
+	f.timeLayout = layout
+	return f
+}
+
+// Indicates whether values of type t are read with the field's time
+// layout
+func (f *Field) usesTimeLayout(t reflect.Type) bool {
+	return f.timeLayout != "" && t == timeType
+}
+
+// Parses a time with the field's layout and stores it in dest
+func (f *Field) decodeTimeLayout(dest reflect.Value, value string) error {
+	result, err := time.Parse(f.timeLayout, value)
+	if err != nil {
+		return fmt.Errorf(
+			"Couldn't parse %s as time in layout %s",
+			value,
+			f.timeLayout,
+		)
+	}
+	dest.Set(reflect.ValueOf(result))
+	return nil
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	. "gopkg.in/check.v1"
+	"strings"
+	"testing"
+	"time"
+)
+
+type TimeSuite struct{}
+
+func TestTime(t *testing.T) {
+	Suite(&TimeSuite{})
+	TestingT(t)
+}
+
+func (s *TimeSuite) TestTimeFields(c *C) {
+	dest := &struct {
+		Cutoff  time.Time
+		Windows []time.Time `conflag:"layout=2006-01-02 15:04"`
+		Holiday time.Time   `conflag:"layout='Jan 2, 2006',default='Dec 25, 2015'"`
+		Zone    *time.Location
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	c.Assert(dest.Holiday, Equals, time.Date(2015, 12, 25, 0, 0, 0, 0, time.UTC))
+
+	config.ConfigReader(
+		strings.NewReader(
+			"cutoff = 2015-06-01T02:00:00+02:00\n" +
+				"windows = 2015-06-01 02:00, 2015-06-08 02:00\n" +
+				"zone = America/New_York\n",
+		),
+	)
+	_, err = config.Args([]string{}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(
+		dest.Cutoff.Equal(time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)),
+		Equals,
+		true,
+	)
+	c.Assert(
+		dest.Windows,
+		DeepEquals,
+		[]time.Time{
+			time.Date(2015, 6, 1, 2, 0, 0, 0, time.UTC),
+			time.Date(2015, 6, 8, 2, 0, 0, 0, time.UTC),
+		},
+	)
+	c.Assert(dest.Zone.String(), Equals, "America/New_York")
+}
+
+func (s *TimeSuite) TestTimeFieldFailures(c *C) {
+	dest := &struct {
+		Cutoff  time.Time
+		Holiday time.Time `conflag:"layout='Jan 2, 2006'"`
+		Zone    *time.Location
+	}{}
+
+	for args, message := range map[string]string{
+		"--cutoff 2015-06-01": "conflag: Invalid value for Cutoff from the " +
+			"command line: Couldn't parse 2015-06-01: expected an RFC 3339 " +
+			"time.",
+		"--holiday 2015-12-25": "conflag: Invalid value for Holiday from " +
+			"the command line: Couldn't parse 2015-12-25 as time in " +
+			"layout Jan 2, 2006.",
+		"--zone Mars/Olympus_Mons": "conflag: Invalid value for Zone from " +
+			"the command line: Couldn't parse Mars/Olympus_Mons: unknown " +
+			"time zone Mars/Olympus_Mons.",
+	} {
+		config, err := New(dest)
+		c.Assert(err, IsNil)
+		_, err = config.Args(strings.Fields(args)).Read()
+		c.Assert(err, NotNil, Commentf("args %s", args))
+		c.Assert(err.Error(), Equals, message)
+	}
+}
+
+func (s *TimeSuite) TestTimeLayout(c *C) {
+	dest := &struct {
+		Cutoff time.Time
+		Dates  map[string]time.Time
+		Count  int
+	}{
+		Cutoff: time.Date(2015, 6, 1, 2, 0, 0, 0, time.UTC),
+	}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	c.Assert(
+		config.Field("Cutoff").usageDescription(),
+		Equals,
+		"(default 2015-06-01T02:00:00Z)",
+	)
+	config.Field("Cutoff").TimeLayout("2006-01-02")
+	c.Assert(
+		config.Field("Cutoff").usageDescription(),
+		Equals,
+		"(default 2015-06-01)",
+	)
+	config.Field("Dates").TimeLayout("2006-01-02")
+
+	c.Assert(
+		func() { config.Field("Count").TimeLayout("2006-01-02") },
+		PanicMatches,
+		"conflag: Only time fields may have a time layout.",
+	)
+	c.Assert(
+		func() { config.Field("Cutoff").TimeLayout("") },
+		PanicMatches,
+		"conflag: Time layouts must not be empty.",
+	)
+
+	_, err = config.Args([]string{"--dates", "start=2015-01-01"}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(
+		dest.Dates,
+		DeepEquals,
+		map[string]time.Time{"start": time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)},
+	)
+}
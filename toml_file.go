@@ -0,0 +1,692 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Reads a config file in TOML, in which each table is a category and
+// each key a file key
+func readTOMLConfigFile(
+	dest map[string]*Field,
+	src io.Reader,
+	source string,
+) error {
+	data, err := ioutil.ReadAll(src)
+	if closer, ok := src.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("conflag: Couldn't read %s: %s.", source, err)
+	}
+
+	parser := &tomlParser{
+		data:    string(data),
+		line:    1,
+		root:    map[string]interface{}{},
+		lines:   map[string]int{},
+		defined: map[string]bool{},
+	}
+	if err := parser.parse(); err != nil {
+		return fmt.Errorf(
+			"conflag: Invalid TOML on line %d of %s: %s.",
+			parser.line,
+			source,
+			err,
+		)
+	}
+
+	reader := newStructuredReader(dest, source, "a table")
+	reader.lines = parser.lines
+	return reader.readObject("", "", parser.root)
+}
+
+// A TOML date, time or datetime, which may only be read into time.Time
+// fields
+type tomlDateTime time.Time
+
+func (d tomlDateTime) fieldText(
+	field *Field,
+	kind fieldType,
+	t reflect.Type,
+) (string, bool) {
+	if t != timeType {
+		return "", false
+	}
+	if field.timeLayout != "" {
+		return time.Time(d).Format(field.timeLayout), true
+	}
+	return time.Time(d).Format(time.RFC3339Nano), true
+}
+
+func (d tomlDateTime) typeName() string {
+	return "a date and time"
+}
+
+// Parses a TOML document into the values read by structuredReader,
+// keeping track of the line each key is set on
+type tomlParser struct {
+	data string
+	pos  int
+	line int
+	root map[string]interface{}
+	// Lines by the path of the key or table header found on them
+	lines map[string]int
+	// The paths of tables given their own header or created by dotted
+	// keys, which can't be given a header
+	defined map[string]bool
+}
+
+func (p *tomlParser) parse() error {
+	table, path := p.root, ""
+	for {
+		p.skipBlank(true)
+		if p.done() {
+			return nil
+		}
+
+		var err error
+		if p.peek() == '[' {
+			table, path, err = p.parseHeader()
+		} else {
+			err = p.parseKeyValue(table, path)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.endLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// Parses a [table] or [[array of tables]] header, returning the table
+// and path that the following keys belong to
+func (p *tomlParser) parseHeader() (map[string]interface{}, string, error) {
+	p.pos++
+	array := p.consume("[")
+	keys, err := p.parseKey()
+	if err != nil {
+		return nil, "", err
+	}
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !p.consume(closing) {
+		return nil, "", fmt.Errorf("Expected %s after table name", closing)
+	}
+
+	table, path := p.root, ""
+	for _, key := range keys[:len(keys)-1] {
+		table, path, err = p.descend(table, path, key)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	key := keys[len(keys)-1]
+	path = joinPath(path, key)
+	p.lines[path] = p.line
+	existing, ok := table[key]
+	if array {
+		tables, isArray := existing.([]interface{})
+		if ok && !isArray {
+			return nil, "", fmt.Errorf("%s is not an array of tables", path)
+		}
+		next := map[string]interface{}{}
+		table[key] = append(tables, next)
+		path = fmt.Sprintf("%s[%d]", path, len(tables))
+		p.lines[path] = p.line
+		return next, path, nil
+	}
+
+	if !ok {
+		existing = map[string]interface{}{}
+		table[key] = existing
+	}
+	next, isTable := existing.(map[string]interface{})
+	if !isTable || p.defined[path] {
+		return nil, "", fmt.Errorf("%s is defined twice", path)
+	}
+	p.defined[path] = true
+	return next, path, nil
+}
+
+// Finds or creates the table named by a key within another, which for
+// an array of tables is the last one in it
+func (p *tomlParser) descend(
+	table map[string]interface{},
+	path string,
+	key string,
+) (map[string]interface{}, string, error) {
+	path = joinPath(path, key)
+	switch existing := table[key].(type) {
+	case nil:
+		next := map[string]interface{}{}
+		table[key] = next
+		return next, path, nil
+	case map[string]interface{}:
+		return existing, path, nil
+	case []interface{}:
+		if len(existing) == 0 {
+			break
+		}
+		if last, ok := existing[len(existing)-1].(map[string]interface{}); ok {
+			return last, fmt.Sprintf("%s[%d]", path, len(existing)-1), nil
+		}
+	}
+	return nil, "", fmt.Errorf("%s is not a table", path)
+}
+
+func (p *tomlParser) parseKeyValue(
+	table map[string]interface{},
+	path string,
+) error {
+	line := p.line
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if !p.consume("=") {
+		return fmt.Errorf("Expected = after key %s", strings.Join(keys, "."))
+	}
+
+	// Tables created by dotted keys can't be given a header later
+	for _, key := range keys[:len(keys)-1] {
+		table, path, err = p.descend(table, path, key)
+		if err != nil {
+			return err
+		}
+		p.defined[path] = true
+	}
+	key := keys[len(keys)-1]
+	path = joinPath(path, key)
+	if _, ok := table[key]; ok {
+		return fmt.Errorf("%s is defined twice", path)
+	}
+	p.lines[path] = line
+
+	p.skipBlank(false)
+	value, err := p.parseValue(path)
+	if err != nil {
+		return err
+	}
+	table[key] = value
+	return nil
+}
+
+// Parses a key, which may be dotted, along with the whitespace
+// around it
+func (p *tomlParser) parseKey() ([]string, error) {
+	keys := []string{}
+	for {
+		p.skipBlank(false)
+		if p.done() {
+			return nil, fmt.Errorf("Expected a key")
+		}
+		var key string
+		var err error
+		switch p.peek() {
+		case '"':
+			key, err = p.parseBasicString()
+		case '\'':
+			key, err = p.parseLiteralString()
+		default:
+			start := p.pos
+			for !p.done() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("Expected a key")
+			}
+			key = p.data[start:p.pos]
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+
+		p.skipBlank(false)
+		if !p.consume(".") {
+			return keys, nil
+		}
+	}
+}
+
+// Parses the value at the given path, which names the values nested
+// in arrays and inline tables
+func (p *tomlParser) parseValue(path string) (interface{}, error) {
+	if p.done() {
+		return nil, fmt.Errorf("Expected a value")
+	}
+	switch p.peek() {
+	case '"':
+		if strings.HasPrefix(p.data[p.pos:], `"""`) {
+			return p.parseMultiLineString(`"""`, true)
+		}
+		return p.parseBasicString()
+	case '\'':
+		if strings.HasPrefix(p.data[p.pos:], "'''") {
+			return p.parseMultiLineString("'''", false)
+		}
+		return p.parseLiteralString()
+	case '[':
+		return p.parseArray(path)
+	case '{':
+		return p.parseInlineTable(path)
+	}
+
+	token := p.scanToken()
+	switch {
+	case token == "true":
+		return true, nil
+	case token == "false":
+		return false, nil
+	case token == "":
+		return nil, fmt.Errorf("Expected a value")
+	case isTOMLDateTime(token):
+		return parseTOMLDateTime(token)
+	}
+	return parseTOMLNumber(token)
+}
+
+// Scans an unquoted value, including the space that may separate the
+// date and time of a datetime
+func (p *tomlParser) scanToken() string {
+	start := p.pos
+	for !p.done() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+		p.pos++
+	}
+	token := p.data[start:p.pos]
+	rest := p.data[p.pos:]
+	isDate := len(token) == 10 && token[4] == '-' && token[7] == '-'
+	if isDate && len(rest) >= 4 && rest[0] == ' ' && rest[3] == ':' {
+		p.pos++
+		for !p.done() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+			p.pos++
+		}
+		token = p.data[start:p.pos]
+	}
+	return token
+}
+
+func (p *tomlParser) parseArray(path string) (interface{}, error) {
+	p.pos++
+	array := []interface{}{}
+	for {
+		p.skipBlank(true)
+		if p.consume("]") {
+			return array, nil
+		}
+		elementPath := fmt.Sprintf("%s[%d]", path, len(array))
+		p.lines[elementPath] = p.line
+		value, err := p.parseValue(elementPath)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+
+		p.skipBlank(true)
+		if p.consume("]") {
+			return array, nil
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf("Expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable(path string) (interface{}, error) {
+	p.pos++
+	table := map[string]interface{}{}
+	p.skipBlank(false)
+	if p.consume("}") {
+		return table, nil
+	}
+	for {
+		if err := p.parseKeyValue(table, path); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if p.consume("}") {
+			return table, nil
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf("Expected , or } in inline table")
+		}
+	}
+}
+
+func (p *tomlParser) parseBasicString() (string, error) {
+	p.pos++
+	var value strings.Builder
+	for {
+		if p.done() || p.peek() == '\n' {
+			return "", fmt.Errorf("Unterminated string")
+		}
+		c := p.peek()
+		switch c {
+		case '"':
+			p.pos++
+			return value.String(), nil
+		case '\\':
+			if err := p.parseEscape(&value); err != nil {
+				return "", err
+			}
+		default:
+			value.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *tomlParser) parseLiteralString() (string, error) {
+	p.pos++
+	end := strings.IndexAny(p.data[p.pos:], "'\n")
+	if end < 0 || p.data[p.pos+end] != '\'' {
+		return "", fmt.Errorf("Unterminated string")
+	}
+	value := p.data[p.pos : p.pos+end]
+	p.pos += end + 1
+	return value, nil
+}
+
+// Parses a string delimited by three double or single quotes, in which
+// a newline right after the opening delimiter is skipped, and for basic
+// strings a backslash at the end of a line skips the whitespace that
+// follows
+func (p *tomlParser) parseMultiLineString(
+	delimiter string,
+	escapes bool,
+) (string, error) {
+	p.pos += len(delimiter)
+	if p.consume("\r\n") || p.consume("\n") {
+		p.line++
+	}
+	var value strings.Builder
+	for {
+		if p.done() {
+			return "", fmt.Errorf("Unterminated string")
+		}
+		if strings.HasPrefix(p.data[p.pos:], delimiter) {
+			// Up to two quotes may come right before the delimiter
+			p.pos += len(delimiter)
+			for i := 0; i < 2 && p.consume(delimiter[:1]); i++ {
+				value.WriteByte(delimiter[0])
+			}
+			return value.String(), nil
+		}
+
+		c := p.peek()
+		switch {
+		case c == '\\' && escapes && p.atLineEndingBackslash():
+			p.pos++
+			for !p.done() && strings.ContainsRune(" \t\r\n", rune(p.peek())) {
+				if p.peek() == '\n' {
+					p.line++
+				}
+				p.pos++
+			}
+		case c == '\\' && escapes:
+			if err := p.parseEscape(&value); err != nil {
+				return "", err
+			}
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			value.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// Indicates whether the backslash at the current position has only
+// whitespace after it on its line
+func (p *tomlParser) atLineEndingBackslash() bool {
+	rest := p.data[p.pos+1:]
+	end := strings.IndexByte(rest, '\n')
+	return end >= 0 && strings.TrimSpace(rest[:end]) == ""
+}
+
+func (p *tomlParser) parseEscape(value *strings.Builder) error {
+	p.pos++
+	if p.done() {
+		return fmt.Errorf("Unterminated string")
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		value.WriteByte('\b')
+	case 't':
+		value.WriteByte('\t')
+	case 'n':
+		value.WriteByte('\n')
+	case 'f':
+		value.WriteByte('\f')
+	case 'r':
+		value.WriteByte('\r')
+	case '"', '\\':
+		value.WriteByte(c)
+	case 'u', 'U':
+		digits := 4
+		if c == 'U' {
+			digits = 8
+		}
+		if p.pos+digits > len(p.data) {
+			return fmt.Errorf("Invalid escape \\%c", c)
+		}
+		code, err := strconv.ParseUint(p.data[p.pos:p.pos+digits], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return fmt.Errorf(
+				"Invalid escape \\%c%s",
+				c,
+				p.data[p.pos:p.pos+digits],
+			)
+		}
+		value.WriteRune(rune(code))
+		p.pos += digits
+	default:
+		return fmt.Errorf("Invalid escape \\%c", c)
+	}
+	return nil
+}
+
+// Skips spaces, tabs and comments, along with newlines if multiLine is
+// set
+func (p *tomlParser) skipBlank(multiLine bool) {
+	for !p.done() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			for !p.done() && p.peek() != '\n' {
+				p.pos++
+			}
+		case multiLine && (c == '\r' || c == '\n'):
+			if c == '\n' {
+				p.line++
+			}
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// Expects nothing but a comment after a key/value pair or header
+func (p *tomlParser) endLine() error {
+	p.skipBlank(false)
+	if p.done() || p.consume("\n") || p.consume("\r\n") {
+		p.line++
+		return nil
+	}
+	return fmt.Errorf("Unexpected %q", p.peek())
+}
+
+func (p *tomlParser) done() bool {
+	return p.pos >= len(p.data)
+}
+
+func (p *tomlParser) peek() byte {
+	return p.data[p.pos]
+}
+
+// Skips over the given text if it comes next
+func (p *tomlParser) consume(text string) bool {
+	if strings.HasPrefix(p.data[p.pos:], text) {
+		p.pos += len(text)
+		return true
+	}
+	return false
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// Indicates whether a value starts like a date or a time, rather than
+// a number
+func isTOMLDateTime(token string) bool {
+	digits := func(n int) bool {
+		for i := 0; i < n; i++ {
+			if !isDigit(token[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return len(token) > 4 && token[4] == '-' && digits(4) ||
+		len(token) > 2 && token[2] == ':' && digits(2)
+}
+
+// Parses any of TOML's datetimes.  Local datetimes and dates are taken
+// to be in the local time zone, and local times to be on no date.
+func parseTOMLDateTime(token string) (interface{}, error) {
+	normalized := strings.ToUpper(strings.Replace(token, " ", "T", 1))
+	if len(normalized) > 10 && normalized[10] == 'T' {
+		offset := normalized[len(normalized)-1] == 'Z' ||
+			strings.ContainsAny(normalized[10:], "+-")
+		if offset {
+			if t, err := time.Parse(time.RFC3339, normalized); err == nil {
+				return tomlDateTime(t), nil
+			}
+		} else {
+			t, err := time.ParseInLocation(
+				"2006-01-02T15:04:05",
+				normalized,
+				time.Local,
+			)
+			if err == nil {
+				return tomlDateTime(t), nil
+			}
+		}
+	} else if len(normalized) == 10 {
+		t, err := time.ParseInLocation("2006-01-02", normalized, time.Local)
+		if err == nil {
+			return tomlDateTime(t), nil
+		}
+	} else if t, err := time.Parse("15:04:05", normalized); err == nil {
+		return tomlDateTime(t), nil
+	}
+	return nil, fmt.Errorf("Invalid datetime %s", token)
+}
+
+// Parses a TOML integer or float.  Integers are given in decimal,
+// whatever base they were written in, so that they suit any numeric
+// field.
+func parseTOMLNumber(token string) (interface{}, error) {
+	invalid := fmt.Errorf("Invalid value %s", token)
+	unsigned := strings.TrimLeft(token, "+-")
+	if len(token)-len(unsigned) > 1 {
+		return nil, invalid
+	}
+	switch unsigned {
+	case "inf":
+		return configNumber(strings.TrimPrefix(token, "+")), nil
+	case "nan":
+		return configNumber("nan"), nil
+	}
+
+	if !strings.ContainsAny(unsigned, ".eE") || isPrefixedInteger(unsigned) {
+		if len(unsigned) > 1 && unsigned[0] == '0' &&
+			!isPrefixedInteger(unsigned) {
+			return nil, invalid
+		}
+		value, err := strconv.ParseInt(token, 0, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		return configNumber(strconv.FormatInt(value, 10)), nil
+	}
+
+	// Underscores and points must each sit between two digits
+	for i := 0; i < len(token); i++ {
+		if token[i] != '_' && token[i] != '.' {
+			continue
+		}
+		if i == 0 || i == len(token)-1 ||
+			!isDigit(token[i-1]) || !isDigit(token[i+1]) {
+			return nil, invalid
+		}
+	}
+	cleaned := strings.Replace(token, "_", "", -1)
+	mantissa := strings.TrimLeft(cleaned, "+-")
+	if len(mantissa) > 1 && mantissa[0] == '0' && isDigit(mantissa[1]) {
+		return nil, invalid
+	}
+	if _, err := strconv.ParseFloat(cleaned, 64); err != nil {
+		return nil, invalid
+	}
+	return configNumber(cleaned), nil
+}
+
+func isPrefixedInteger(value string) bool {
+	return strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0o") ||
+		strings.HasPrefix(value, "0b")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
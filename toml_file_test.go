@@ -0,0 +1,244 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	. "gopkg.in/check.v1"
+	"strings"
+	"testing"
+	"time"
+)
+
+type TOMLFileSuite struct{}
+
+func TestTOMLFile(t *testing.T) {
+	Suite(&TOMLFileSuite{})
+	TestingT(t)
+}
+
+type tomlTestConfig struct {
+	Port     int
+	Mode     uint32
+	Ratio    float64
+	Name     string
+	Motd     string
+	Verbose  bool
+	Started  time.Time
+	Peers    []string
+	Ports    []uint16
+	Labels   map[string]string
+	Database struct {
+		Host string
+		Pool struct {
+			Size    uint
+			Timeout time.Duration
+		}
+	}
+}
+
+func (s *TOMLFileSuite) TestRead(c *C) {
+	dest := &tomlTestConfig{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+
+	file := `
+# Server settings
+port = 8_080 # inline comment
+mode = 0o755
+ratio = 1.5e-1
+name = 'C:\server'
+motd = """
+Hello, \
+  world!\tWelcome"""
+verbose = true
+started = 1979-05-27 07:32:00-08:00
+peers = [
+	"a",  # first
+	"b, c",
+]
+ports = [80, 0x1BB]
+labels = { env = "prod", "team name" = "core" }
+
+[database]
+host = "db.local"
+pool.size = 4
+pool.timeout = "5s"
+`
+	err = readTOMLConfigFile(
+		config.fields,
+		strings.NewReader(file),
+		configFileSource,
+	)
+	c.Assert(err, IsNil)
+
+	c.Assert(config.fields["Port"].parsedValue, Equals, "8080")
+	c.Assert(config.fields["Mode"].parsedValue, Equals, "493")
+	c.Assert(config.fields["Ratio"].parsedValue, Equals, "1.5e-1")
+	c.Assert(config.fields["Name"].parsedValue, Equals, `C:\server`)
+	c.Assert(
+		config.fields["Motd"].parsedValue,
+		Equals,
+		"Hello, world!\tWelcome",
+	)
+	c.Assert(config.fields["Verbose"].parsedValue, Equals, "true")
+	c.Assert(
+		config.fields["Started"].parsedValue,
+		Equals,
+		"1979-05-27T07:32:00-08:00",
+	)
+	c.Assert(
+		config.fields["Peers"].parsedValues,
+		DeepEquals,
+		[]string{`"a"`, `"b, c"`},
+	)
+	c.Assert(
+		config.fields["Ports"].parsedValues,
+		DeepEquals,
+		[]string{`"80"`, `"443"`},
+	)
+	c.Assert(
+		config.fields["Labels"].parsedValues,
+		DeepEquals,
+		[]string{`"env=prod"`, `"team name=core"`},
+	)
+	c.Assert(config.fields["Database.Host"].parsedValue, Equals, "db.local")
+	c.Assert(config.fields["Database.Pool.Size"].parsedValue, Equals, "4")
+	c.Assert(config.fields["Database.Pool.Timeout"].parsedValue, Equals, "5s")
+}
+
+func (s *TOMLFileSuite) TestTypeErrors(c *C) {
+	cases := map[string]string{
+		"\nport = \"80\"": "conflag: Expected an integer, got a string " +
+			"at port (line 2) in config file.",
+		"port = 8.5": "conflag: Expected an integer, got a number " +
+			"at port (line 1) in config file.",
+		"name = 1979-05-27": "conflag: Expected a string, got a date " +
+			"and time at name (line 1) in config file.",
+		"verbose = 1": "conflag: Expected a boolean, got a number " +
+			"at verbose (line 1) in config file.",
+		"ports = [\n  80,\n  true,\n]": "conflag: Expected an integer, " +
+			"got a boolean at ports[1] (line 3) in config file.",
+		"labels = { env = [] }": "conflag: Expected a string, " +
+			"got an array at labels.env (line 1) in config file.",
+		"[database]\n\nport = 5432": "conflag: Invalid configuration " +
+			"file key at database.port (line 3) in config file.",
+	}
+	for file, expected := range cases {
+		config, err := New(&tomlTestConfig{})
+		c.Assert(err, IsNil)
+		err = readTOMLConfigFile(
+			config.fields,
+			strings.NewReader(file),
+			configFileSource,
+		)
+		c.Assert(err, NotNil, Commentf("%s", file))
+		c.Assert(err.Error(), Equals, expected)
+	}
+}
+
+func (s *TOMLFileSuite) TestSyntaxErrors(c *C) {
+	cases := map[string]string{
+		"port = 80\nport = 81":       "line 2 of config file: port is defined twice",
+		"[database]\n[database]":     "line 2 of config file: database is defined twice",
+		"port = 80 name = \"a\"":     "line 1 of config file: Unexpected 'n'",
+		"name = \"unterminated\nx=1": "line 1 of config file: Unterminated string",
+		"\n\nport = 08":              "line 3 of config file: Invalid value 08",
+		"port =":                     "line 1 of config file: Expected a value",
+		"ports = [1 2]":              "line 1 of config file: Expected , or ] in array",
+		"name = \"\\q\"":             "line 1 of config file: Invalid escape \\q",
+		"[database\nhost = \"a\"":    "line 1 of config file: Expected ] after table name",
+		"started = 1979-13-01":       "line 1 of config file: Invalid datetime 1979-13-01",
+		"[a]\nb.c = 1\n[a.b]":        "line 3 of config file: a.b is defined twice",
+		"a = []\n[a.b]":              "line 2 of config file: a is not a table",
+	}
+	for file, expected := range cases {
+		config, err := New(&tomlTestConfig{})
+		c.Assert(err, IsNil)
+		err = readTOMLConfigFile(
+			config.fields,
+			strings.NewReader(file),
+			configFileSource,
+		)
+		c.Assert(err, NotNil, Commentf("%s", file))
+		c.Assert(err.Error(), Equals, "conflag: Invalid TOML on "+expected+".")
+	}
+}
+
+func (s *TOMLFileSuite) TestTruncatedDocuments(c *C) {
+	cases := map[string]string{
+		"[":     "Expected a key",
+		"[a.":   "Expected a key",
+		"[[":    "Expected a key",
+		"a.":    "Expected a key",
+		"a":     "Expected = after key a",
+		"a =":   "Expected a value",
+		"a = [": "Expected a value",
+	}
+	for file, expected := range cases {
+		config, err := New(&tomlTestConfig{})
+		c.Assert(err, IsNil)
+		err = readTOMLConfigFile(
+			config.fields,
+			strings.NewReader(file),
+			configFileSource,
+		)
+		c.Assert(err, NotNil, Commentf("%s", file))
+		c.Assert(
+			err.Error(),
+			Equals,
+			"conflag: Invalid TOML on line 1 of config file: "+expected+".",
+		)
+	}
+}
+
+func (s *TOMLFileSuite) TestNativeValues(c *C) {
+	dest := &tomlTestConfig{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.Field("Started").TimeLayout("2006-01-02")
+
+	file := `
+		mode = 0b1010
+		ratio = -inf
+		started = 2015-06-01
+		ports = []`
+	_, err = config.ConfigReader(strings.NewReader(file)).
+		ConfigFormat(TOMLFormat).
+		Args([]string{}).
+		Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Mode, Equals, uint32(10))
+	c.Assert(dest.Ratio < 0 && dest.Ratio*2 == dest.Ratio, Equals, true)
+	c.Assert(dest.Started.Format("2006-01-02"), Equals, "2015-06-01")
+	c.Assert(dest.Ports, DeepEquals, []uint16{})
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Units selects the unit suffixes accepted by a numeric field, as set
+// with Field.Units.  Whatever the units, numbers may be written with
+// Go's base prefixes and digit separators, e.g. 0x1F, 0o755 or
+// 1_000_000, and must fit in the field's type.
+type Units int
+
+const (
+	// NoUnits accepts plain numbers only.  This is the default.
+	NoUnits Units = iota
+	// SIUnits accepts the SI suffixes k (or K), M, G, T, P and E,
+	// e.g. 1.5k for 1500.
+	SIUnits
+	// ByteUnits accepts the decimal byte suffixes B, KB, MB, GB, TB, PB
+	// and EB, and the binary suffixes KiB, MiB, GiB, TiB, PiB and EiB,
+	// in any case, e.g. 64MiB for 67108864.
+	ByteUnits
+	// PercentUnits accepts a percentage as a fraction, e.g. 50% for
+	// 0.5.
+	PercentUnits
+)
+
+var siMultipliers = map[string]int64{
+	"k": 1e3,
+	"K": 1e3,
+	"M": 1e6,
+	"G": 1e9,
+	"T": 1e12,
+	"P": 1e15,
+	"E": 1e18,
+}
+
+var byteMultipliers = map[string]int64{
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"eb":  1e18,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+	"eib": 1 << 60,
+}
+
+// Binary byte units from largest to smallest, for formatting
+var binaryByteUnits = []string{"EiB", "PiB", "TiB", "GiB", "MiB", "KiB"}
+
+// Converts a number with a unit suffix into a plain decimal number.
+// The result is written as an integer whenever it's a whole number, so
+// that it can be decoded for integer fields.  Values without a suffix,
+// and numbers with a base prefix such as 0x, are returned unchanged.
+func applyUnits(value string, units Units) (string, error) {
+	if units == NoUnits {
+		return value, nil
+	}
+
+	trimmed := strings.TrimSpace(value)
+	unsigned := strings.ToLower(strings.TrimLeft(trimmed, "+-"))
+	for _, prefix := range []string{"0x", "0o", "0b"} {
+		if strings.HasPrefix(unsigned, prefix) {
+			return value, nil
+		}
+	}
+
+	suffixStart := strings.LastIndexFunc(
+		trimmed,
+		func(r rune) bool { return unicode.IsDigit(r) || r == '.' },
+	) + 1
+	number := strings.TrimSpace(trimmed[:suffixStart])
+	suffix := strings.TrimSpace(trimmed[suffixStart:])
+	if suffix == "" {
+		return value, nil
+	}
+
+	var multiplier *big.Rat
+	switch units {
+	case SIUnits:
+		if m, ok := siMultipliers[suffix]; ok {
+			multiplier = big.NewRat(m, 1)
+		}
+	case ByteUnits:
+		if m, ok := byteMultipliers[strings.ToLower(suffix)]; ok {
+			multiplier = big.NewRat(m, 1)
+		}
+	case PercentUnits:
+		if suffix == "%" {
+			multiplier = big.NewRat(1, 100)
+		}
+	}
+	if multiplier == nil {
+		return "", fmt.Errorf("unknown unit %s", suffix)
+	}
+
+	amount, ok := new(big.Rat).SetString(strings.Replace(number, "_", "", -1))
+	if !ok || number == "" {
+		return "", errors.New("invalid number")
+	}
+	amount.Mul(amount, multiplier)
+	if amount.IsInt() {
+		return amount.Num().String(), nil
+	}
+	f, _ := amount.Float64()
+	return strconv.FormatFloat(f, 'g', -1, 64), nil
+}
+
+// ByteSize is a number of bytes, which may be written in
+// configuration with any of the suffixes accepted by ByteUnits,
+// e.g. 64MiB or 1.5GB.
+type ByteSize uint64
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	value, err := applyUnits(string(text), ByteUnits)
+	if err != nil {
+		return err
+	}
+	size, err := strconv.ParseUint(integerLiteral(value), 0, 64)
+	if err != nil {
+		return fmt.Errorf("invalid byte size %s", text)
+	}
+	*b = ByteSize(size)
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler, using the largest
+// binary unit that represents the size exactly.
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// String formats the size using the largest binary unit that
+// represents it exactly, e.g. 64MiB.
+func (b ByteSize) String() string {
+	for i, unit := range binaryByteUnits {
+		multiplier := ByteSize(1) << uint(10*(len(binaryByteUnits)-i))
+		if b != 0 && b%multiplier == 0 {
+			return strconv.FormatUint(uint64(b/multiplier), 10) + unit
+		}
+	}
+	return strconv.FormatUint(uint64(b), 10) + "B"
+}
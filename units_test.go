@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	. "gopkg.in/check.v1"
+	"strings"
+	"testing"
+)
+
+type UnitsSuite struct{}
+
+func TestUnits(t *testing.T) {
+	Suite(&UnitsSuite{})
+	TestingT(t)
+}
+
+func (s *UnitsSuite) TestApplyUnits(c *C) {
+	cases := []struct {
+		value    string
+		units    Units
+		expected string
+	}{
+		{"1.5k", NoUnits, "1.5k"},
+		{"1.5k", SIUnits, "1500"},
+		{"2M", SIUnits, "2000000"},
+		{"1_000k", SIUnits, "1000000"},
+		{"0x1F", SIUnits, "0x1F"},
+		{"42", SIUnits, "42"},
+		{"1.5m", SIUnits, ""},
+		{"64MiB", ByteUnits, "67108864"},
+		{"64 mib", ByteUnits, "67108864"},
+		{"1.5KB", ByteUnits, "1500"},
+		{"16EiB", ByteUnits, "18446744073709551616"},
+		{"1.1B", ByteUnits, "1.1"},
+		{"50%", PercentUnits, "0.5"},
+		{"150%", PercentUnits, "1.5"},
+		{"%", PercentUnits, ""},
+		{"50 percent", PercentUnits, ""},
+	}
+	for _, test := range cases {
+		result, err := applyUnits(test.value, test.units)
+		if test.expected == "" {
+			c.Assert(err, NotNil, Commentf("value %s", test.value))
+		} else {
+			c.Assert(err, IsNil, Commentf("value %s", test.value))
+			c.Assert(result, Equals, test.expected)
+		}
+	}
+}
+
+func (s *UnitsSuite) TestByteSize(c *C) {
+	var size ByteSize
+	c.Assert(size.UnmarshalText([]byte("64MiB")), IsNil)
+	c.Assert(size, Equals, ByteSize(64<<20))
+	c.Assert(size.String(), Equals, "64MiB")
+
+	c.Assert(size.UnmarshalText([]byte("1536")), IsNil)
+	c.Assert(size.String(), Equals, "1536B")
+	c.Assert(ByteSize(1536*1024).String(), Equals, "1536KiB")
+	c.Assert(ByteSize(0).String(), Equals, "0B")
+
+	c.Assert(size.UnmarshalText([]byte("1.1B")), NotNil)
+	c.Assert(size.UnmarshalText([]byte("-1KiB")), NotNil)
+	c.Assert(size.UnmarshalText([]byte("16EiB")), NotNil)
+}
+
+func (s *UnitsSuite) TestFieldUnits(c *C) {
+	dest := &struct {
+		Rate      int `conflag:"units=si"`
+		Ratio     float64
+		Cache     ByteSize
+		Limits    []uint64
+		Threshold map[string]float32
+	}{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	config.Field("Ratio").Units(PercentUnits)
+	config.Field("Limits").Units(ByteUnits)
+	config.Field("Threshold").Units(PercentUnits)
+
+	config.ConfigReader(
+		strings.NewReader(
+			"rate = 1.5k\nratio = 25%\ncache = 1GiB\n" +
+				"limits = 1KiB, 2kb\n[threshold]\nwarn = 80%",
+		),
+	)
+	_, err = config.Args([]string{}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Rate, Equals, 1500)
+	c.Assert(dest.Ratio, Equals, 0.25)
+	c.Assert(dest.Cache, Equals, ByteSize(1<<30))
+	c.Assert(dest.Limits, DeepEquals, []uint64{1024, 2000})
+	c.Assert(dest.Threshold, DeepEquals, map[string]float32{"warn": 0.8})
+
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	_, err = config.Args([]string{"--rate", "1.0005k"}).Read()
+	c.Assert(err, NotNil)
+	c.Assert(
+		err.Error(),
+		Equals,
+		"conflag: Invalid value for Rate from the command line: "+
+			"Couldn't parse 1000.5 as integer (from 1.0005k).",
+	)
+}
+
+func (s *UnitsSuite) TestUnitsOnNonNumericFieldFails(c *C) {
+	dest := &struct{ Name string }{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+
+	defer func() {
+		c.Assert(recover(), NotNil)
+	}()
+	config.Field("Name").Units(SIUnits)
+}
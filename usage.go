@@ -33,7 +33,13 @@
 package conflag
 
 import (
+	"encoding"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 )
 
 const minUsageWidth = 10
@@ -69,11 +75,15 @@ func (c *Config) Usage(width uint) string {
 		sections = append(sections, strings.Join(formattedParagraphs, "\n"))
 	}
 
-	keys, keysWidth := formatFieldKeys(c.fields, c.fieldKeysInOrder)
+	keys, keysWidth := formatFieldKeys(
+		c.fields,
+		c.fieldKeysInOrder,
+		c.envVarNames(),
+	)
 
 	descriptions := []string{}
 	for _, k := range c.fieldKeysInOrder {
-		descriptions = append(descriptions, c.fields[k].description)
+		descriptions = append(descriptions, c.fields[k].usageDescription())
 	}
 
 	var combinedArgInfo []string
@@ -88,22 +98,57 @@ func (c *Config) Usage(width uint) string {
 		combinedArgInfo = formatArgsVertical(keys, descriptions, int(width))
 	}
 	sections = append(sections, combinedArgInfo...)
+	sections = append(sections, c.formatConfigSearches(int(width))...)
 
 	return strings.Join(sections, "\n\n")
 }
 
+// Lists the places searched for each config file set by
+// SearchConfigFile or SearchConfigFiles, in the order they're used
+func (c *Config) formatConfigSearches(width int) []string {
+	sections := []string{}
+	indentation := strings.Repeat(" ", flagIndentDepth)
+	for _, file := range c.files {
+		if file.search == "" {
+			continue
+		}
+
+		paths := c.configSearchPaths(file.search)
+		heading := "Config file, the first found of:"
+		if file.searchAll {
+			heading = "Config files, each overriding the last:"
+			for i, j := 0, len(paths)-1; i < j; i, j = i+1, j-1 {
+				paths[i], paths[j] = paths[j], paths[i]
+			}
+		}
+
+		lines := []string{restrictWidthByWords(heading, width)}
+		for _, path := range paths {
+			lines = append(lines, indentation+path)
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	}
+	return sections
+}
+
 func formatFieldKeys(
 	fields map[string]*Field,
 	fieldKeysInOrder []string,
+	envVarNames map[*Field]string,
 ) (sections []string, maxWidth int) {
 	sections = []string{}
 	maxWidth = 0
-	indentation := strings.Repeat(" ", flagIndentDepth)
 
 	for _, key := range fieldKeysInOrder {
 		field := fields[key]
 		lines := []string{}
 
+		// Fields in nested file categories, such as database.replica,
+		// are indented one level further for each category they're
+		// nested in beyond the first
+		depth := strings.Count(field.fileCategory, ".") + 1
+		indentation := strings.Repeat(" ", flagIndentDepth*depth)
+
 		fieldComponents := []string{}
 		if field.shortFlag != 0 {
 			fieldComponents = append(
@@ -131,6 +176,14 @@ func formatFieldKeys(
 			lines = append(lines, fileLine)
 		}
 
+		if name, ok := envVarNames[field]; ok {
+			lines = append(lines, indentation+"$"+name)
+		}
+
+		if len(field.choices) != 0 && len(lines) != 0 {
+			lines[0] += " {" + strings.Join(field.choices, "|") + "}"
+		}
+
 		for _, line := range lines {
 			if strlen(line) > maxWidth {
 				maxWidth = strlen(line)
@@ -142,6 +195,96 @@ func formatFieldKeys(
 	return
 }
 
+// Builds the description to display for a field, noting its default
+// value if it isn't the zero value for its type
+func (f *Field) usageDescription() string {
+	defaultValue := f.formatDefault()
+	if defaultValue == "" {
+		return f.description
+	}
+	if f.description == "" {
+		return "(default " + defaultValue + ")"
+	}
+	return f.description + " (default " + defaultValue + ")"
+}
+
+// Formats the value a field held before anything was read into it the
+// way it would be written in a config file
+func (f *Field) formatDefault() string {
+	defaultValue := f.defaultValue
+	if defaultValue.IsZero() {
+		return ""
+	}
+
+	switch f.kind {
+	case sliceFieldType:
+		elements := []string{}
+		for i := 0; i < defaultValue.Len(); i++ {
+			elements = append(
+				elements,
+				f.formatListElement(f.formatValue(defaultValue.Index(i), f.elemKind)),
+			)
+		}
+		return strings.Join(elements, string([]rune{f.separator}))
+	case mapFieldType:
+		entries := []string{}
+		iter := defaultValue.MapRange()
+		for iter.Next() {
+			entry := formatScalar(iter.Key(), f.keyKind) + "=" +
+				f.formatValue(iter.Value(), f.elemKind)
+			entries = append(entries, f.formatListElement(entry))
+		}
+		sort.Strings(entries)
+		return strings.Join(entries, string([]rune{f.separator}))
+	default:
+		if f.pointer {
+			return f.formatValue(defaultValue.Elem(), f.kind)
+		}
+		return f.formatValue(defaultValue, f.kind)
+	}
+}
+
+// Formats a single value, or a single element or map value for slice
+// and map fields, the way it would be decoded for the field
+func (f *Field) formatValue(value reflect.Value, kind fieldType) string {
+	if f.usesTimeLayout(value.Type()) {
+		return value.Interface().(time.Time).Format(f.timeLayout)
+	}
+	return formatScalar(value, kind)
+}
+
+// Quotes a list element if it couldn't otherwise be read back as one
+func (f *Field) formatListElement(element string) string {
+	if strings.ContainsRune(element, f.separator) ||
+		strings.ContainsRune(element, '"') {
+		return quoteListElement(element)
+	}
+	return element
+}
+
+func formatScalar(value reflect.Value, kind fieldType) string {
+	if kind == durationFieldType {
+		return formatDuration(time.Duration(value.Int()))
+	}
+
+	// Marshaling methods are commonly declared on pointer receivers,
+	// so work from an addressable copy of the value
+	pointer := reflect.New(value.Type())
+	pointer.Elem().Set(value)
+	if marshaler, ok := pointer.Interface().(encoding.TextMarshaler); ok {
+		if text, err := marshaler.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	if kind == flagValueFieldType {
+		return pointer.Interface().(flag.Value).String()
+	}
+	if stringer, ok := pointer.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprint(value.Interface())
+}
+
 func formatArgsSideBySide(
 	keys []string,
 	descriptions []string,
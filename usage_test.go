@@ -35,6 +35,7 @@ package conflag
 import (
 	. "gopkg.in/check.v1"
 	"testing"
+	"time"
 )
 
 type UsageSuite struct {
@@ -206,3 +207,174 @@ func (s *UsageSuite) TestFormatting(c *C) {
 
 	c.Assert(s.config.Usage(1), Equals, s.config.Usage(minUsageWidth))
 }
+
+func (s *UsageSuite) TestDefaults(c *C) {
+	configStruct := &struct {
+		Timeout time.Duration
+		Port    int
+		Peers   []string
+		Labels  map[string]string
+		Retries *int
+		Unset   string
+		UnsetP  *int
+	}{
+		Timeout: 36 * time.Hour,
+		Port:    80,
+		Peers:   []string{"a", "b,c"},
+		Labels:  map[string]string{"team": "infra", "env": "prod"},
+		Retries: new(int),
+	}
+	config, err := New(configStruct)
+	c.Assert(err, IsNil)
+	config.Field("Port").Description("Port to serve on.")
+
+	c.Assert(config.Field("Timeout").usageDescription(), Equals, "(default 1d12h)")
+	c.Assert(
+		config.Field("Port").usageDescription(),
+		Equals,
+		"Port to serve on. (default 80)",
+	)
+	c.Assert(
+		config.Field("Peers").usageDescription(),
+		Equals,
+		`(default a,"b,c")`,
+	)
+	c.Assert(
+		config.Field("Labels").usageDescription(),
+		Equals,
+		"(default env=prod,team=infra)",
+	)
+	c.Assert(config.Field("Retries").usageDescription(), Equals, "(default 0)")
+	c.Assert(config.Field("Unset").usageDescription(), Equals, "")
+	c.Assert(config.Field("UnsetP").usageDescription(), Equals, "")
+
+	_, err = config.Args([]string{"--port", "7", "--unset", "x"}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(
+		config.Field("Port").usageDescription(),
+		Equals,
+		"Port to serve on. (default 80)",
+	)
+	c.Assert(config.Field("Unset").usageDescription(), Equals, "")
+	config.Field("Unset").Default("y")
+	c.Assert(config.Field("Unset").usageDescription(), Equals, "(default y)")
+}
+
+func (s *UsageSuite) TestChoices(c *C) {
+	configStruct := &struct {
+		Level   string
+		Backend string
+	}{}
+	config, err := New(configStruct)
+	c.Assert(err, IsNil)
+	config.Field("Level").ShortFlag('l').Choices("debug", "info")
+	config.Field("Backend").LongFlag("").Choices("s3", "gcs")
+
+	keys, _ := formatFieldKeys(
+		config.fields,
+		config.fieldKeysInOrder,
+		config.envVarNames(),
+	)
+	c.Assert(
+		keys,
+		DeepEquals,
+		[]string{
+			"  -l, --level {debug|info}\n  level",
+			"  backend {s3|gcs}",
+		},
+	)
+}
+
+func (s *UsageSuite) TestNestedIndentation(c *C) {
+	configStruct := &struct {
+		Port     int
+		Database struct {
+			Host    string
+			Replica struct{ Host string }
+		}
+	}{}
+	config, err := New(configStruct)
+	c.Assert(err, IsNil)
+	config.Field("Database.Replica.Host").FileCategory("replica")
+
+	keys, _ := formatFieldKeys(
+		config.fields,
+		config.fieldKeysInOrder,
+		config.envVarNames(),
+	)
+	c.Assert(
+		keys,
+		DeepEquals,
+		[]string{
+			"  --port\n  port",
+			"  --database.host\n  database.host",
+			"  --database.replica.host\n  replica.host",
+		},
+	)
+
+	config.Field("Database.Replica.Host").FileCategory("database.replica")
+	keys, _ = formatFieldKeys(
+		config.fields,
+		config.fieldKeysInOrder,
+		config.envVarNames(),
+	)
+	c.Assert(
+		keys[2],
+		Equals,
+		"    --database.replica.host\n    database.replica.host",
+	)
+}
+
+func (s *UsageSuite) TestEnvVars(c *C) {
+	configStruct := &struct {
+		Port     int
+		Database struct{ Host string }
+		Secret   string `conflag:"env=DB_PASSWORD"`
+	}{}
+	config, err := New(configStruct)
+	c.Assert(err, IsNil)
+	config.EnvPrefix("MYAPP")
+	config.Field("Port").FileKey("")
+
+	keys, _ := formatFieldKeys(
+		config.fields,
+		config.fieldKeysInOrder,
+		config.envVarNames(),
+	)
+	c.Assert(
+		keys,
+		DeepEquals,
+		[]string{
+			"  --port",
+			"  --database.host\n  database.host\n  $MYAPP_DATABASE_HOST",
+			"  --secret\n  secret\n  $DB_PASSWORD",
+		},
+	)
+}
+
+func (s *UsageSuite) TestConfigSearches(c *C) {
+	configStruct := &struct{ Port int }{}
+	config, err := New(configStruct)
+	c.Assert(err, IsNil)
+	config.Environment([]string{"HOME=/home/me"})
+	config.ConfigSearchFallbacks("/etc/myapp")
+	config.SearchConfigFile("myapp/config.ini")
+	config.SearchConfigFiles("myapp/extra.ini")
+
+	c.Assert(
+		config.Usage(60),
+		Equals,
+		"  --port    \n"+
+			"  port\n"+
+			"\n"+
+			"Config file, the first found of:\n"+
+			"  /home/me/.config/myapp/config.ini\n"+
+			"  /etc/xdg/myapp/config.ini\n"+
+			"  /etc/myapp/config.ini\n"+
+			"\n"+
+			"Config files, each overriding the last:\n"+
+			"  /etc/myapp/extra.ini\n"+
+			"  /etc/xdg/myapp/extra.ini\n"+
+			"  /home/me/.config/myapp/extra.ini",
+	)
+}
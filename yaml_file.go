@@ -0,0 +1,730 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Reads a config file in YAML, in which each key is a file key and
+// each nested mapping a category.  Only the common subset of YAML is
+// supported: block mappings and sequences, single-line flow sequences
+// and mappings, plain and quoted scalars, literal and folded block
+// scalars, and comments.  Plain scalars may be read into a field of
+// any type, as in INI files, while quoted and block scalars are
+// strings.
+func readYAMLConfigFile(
+	dest map[string]*Field,
+	src io.Reader,
+	source string,
+) error {
+	data, err := ioutil.ReadAll(src)
+	if closer, ok := src.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("conflag: Couldn't read %s: %s.", source, err)
+	}
+
+	text := strings.Replace(string(data), "\r\n", "\n", -1)
+	parser := &yamlParser{
+		lines:   strings.Split(strings.TrimSuffix(text, "\n"), "\n"),
+		valueAt: map[string]int{},
+		errorAt: 1,
+	}
+	document, err := parser.parse()
+	if err != nil {
+		return fmt.Errorf(
+			"conflag: Invalid YAML on line %d of %s: %s.",
+			parser.errorAt,
+			source,
+			err,
+		)
+	}
+	if document == nil {
+		return nil
+	}
+	object, ok := document.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf(
+			"conflag: Expected a YAML mapping at the top level of %s.",
+			source,
+		)
+	}
+
+	reader := newStructuredReader(dest, source, "a mapping")
+	reader.lines = parser.valueAt
+	return reader.readObject("", "", object)
+}
+
+// A plain YAML scalar, whose type isn't fixed by its syntax, so that it
+// may be read into a field of any kind
+type untypedScalar string
+
+func (s untypedScalar) fieldText(
+	field *Field,
+	kind fieldType,
+	t reflect.Type,
+) (string, bool) {
+	return string(s), true
+}
+
+func (s untypedScalar) typeName() string {
+	return "a string"
+}
+
+// Parses a YAML document into the values read by structuredReader, one
+// line at a time, keeping track of the line each value is found on
+type yamlParser struct {
+	lines []string
+	// The index of the next line to parse
+	index int
+	// Lines by the path of the value found on them
+	valueAt map[string]int
+	// The line an error was found on
+	errorAt int
+	// Whether the document has been started by its first content or
+	// a --- marker, and whether a later marker has ended it
+	started bool
+	ended   bool
+	// The index of the marker ending the document
+	endMarker int
+}
+
+func (p *yamlParser) parse() (interface{}, error) {
+	value, err := p.parseBlock(0, "")
+	if err != nil {
+		return nil, err
+	}
+	if p.nextContent() {
+		return nil, p.fail(p.index, "Unexpected indentation")
+	}
+
+	// Only a single document may be given
+	for _, line := range p.lines[p.index:] {
+		if stripYAMLComment(line) != "" {
+			return nil, p.fail(
+				p.endMarker,
+				"Multiple documents aren't supported",
+			)
+		}
+	}
+	return value, nil
+}
+
+// Parses the mapping, sequence or scalar on the following lines,
+// provided that they're indented by at least minIndent
+func (p *yamlParser) parseBlock(minIndent int, path string) (interface{}, error) {
+	if !p.nextContent() {
+		return nil, nil
+	}
+	indent, text, err := p.splitIndent(p.index)
+	if err != nil || indent < minIndent {
+		return nil, err
+	}
+
+	switch {
+	case isSequenceItem(text):
+		return p.parseSequence(indent, path)
+	case findMappingColon(text) >= 0:
+		return p.parseMapping(indent, path)
+	}
+	line := p.index
+	p.index++
+	return p.parseInlineValue(text, path, line)
+}
+
+func (p *yamlParser) parseMapping(
+	indent int,
+	path string,
+) (interface{}, error) {
+	mapping := map[string]interface{}{}
+	for p.nextContent() {
+		lineIndent, text, err := p.splitIndent(p.index)
+		if err != nil {
+			return nil, err
+		}
+		if lineIndent < indent {
+			break
+		}
+		if lineIndent > indent {
+			return nil, p.fail(p.index, "Unexpected indentation")
+		}
+
+		colon := findMappingColon(text)
+		if colon <= 0 {
+			return nil, p.fail(p.index, "Expected a mapping key")
+		}
+		key, err := parseYAMLKey(strings.TrimSpace(text[:colon]))
+		if err != nil {
+			return nil, p.fail(p.index, "%s", err)
+		}
+		keyPath := joinPath(path, key)
+		if _, ok := mapping[key]; ok {
+			return nil, p.fail(p.index, "%s is defined twice", keyPath)
+		}
+		p.valueAt[keyPath] = p.index + 1
+
+		line := p.index
+		p.index++
+		rest := strings.TrimSpace(text[colon+1:])
+		var value interface{}
+		if rest == "" || rest[0] == '#' {
+			value, err = p.parseNestedBlock(indent, keyPath)
+		} else {
+			value, err = p.parseInlineValue(rest, keyPath, line)
+		}
+		if err != nil {
+			return nil, err
+		}
+		mapping[key] = value
+	}
+	return mapping, nil
+}
+
+// Parses the block holding the value of a mapping key with nothing
+// after its colon, which is either more indented than the key or a
+// sequence at the same indentation
+func (p *yamlParser) parseNestedBlock(
+	indent int,
+	path string,
+) (interface{}, error) {
+	if !p.nextContent() {
+		return nil, nil
+	}
+	nextIndent, text, err := p.splitIndent(p.index)
+	if err != nil {
+		return nil, err
+	}
+	if nextIndent == indent && isSequenceItem(text) {
+		return p.parseSequence(indent, path)
+	}
+	return p.parseBlock(indent+1, path)
+}
+
+func (p *yamlParser) parseSequence(
+	indent int,
+	path string,
+) (interface{}, error) {
+	sequence := []interface{}{}
+	for p.nextContent() {
+		lineIndent, text, err := p.splitIndent(p.index)
+		if err != nil {
+			return nil, err
+		}
+		if lineIndent < indent || !isSequenceItem(text) {
+			if lineIndent > indent {
+				return nil, p.fail(p.index, "Unexpected indentation")
+			}
+			break
+		}
+		if lineIndent > indent {
+			return nil, p.fail(p.index, "Unexpected indentation")
+		}
+
+		itemPath := fmt.Sprintf("%s[%d]", path, len(sequence))
+		p.valueAt[itemPath] = p.index + 1
+		item := strings.TrimLeft(text[1:], " ")
+		itemIndent := indent + len(text) - len(item)
+
+		var value interface{}
+		switch {
+		case item == "" || item[0] == '#':
+			p.index++
+			value, err = p.parseBlock(indent+1, itemPath)
+		case isSequenceItem(item) || findMappingColon(item) >= 0:
+			// The item's own block starts after the dash, so read it as
+			// though the dash were a space
+			p.lines[p.index] = strings.Repeat(" ", itemIndent) + item
+			value, err = p.parseBlock(itemIndent, itemPath)
+		default:
+			line := p.index
+			p.index++
+			value, err = p.parseInlineValue(item, itemPath, line)
+		}
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, value)
+	}
+	return sequence, nil
+}
+
+// Parses a value given on the same line as its key or sequence dash,
+// where line is the index of that line
+func (p *yamlParser) parseInlineValue(
+	text string,
+	path string,
+	line int,
+) (interface{}, error) {
+	switch text[0] {
+	case '|', '>':
+		return p.parseBlockScalar(text, line)
+	case '[', '{':
+		flow := &yamlFlowParser{text: text, parser: p, line: line}
+		value, err := flow.parseValue(path)
+		if err == nil {
+			err = flow.end()
+		}
+		if err != nil {
+			return nil, p.fail(line, "%s", err)
+		}
+		return value, nil
+	case '&', '*', '!':
+		return nil, p.fail(
+			line,
+			"Anchors, aliases and tags aren't supported",
+		)
+	}
+
+	value, rest, err := parseYAMLScalar(text, "")
+	if err == nil && rest != "" && rest[0] != '#' {
+		err = fmt.Errorf("Unexpected %s", rest)
+	}
+	if err != nil {
+		return nil, p.fail(line, "%s", err)
+	}
+	return value, nil
+}
+
+// Parses a literal (|) or folded (>) block scalar, whose header is
+// given on the line at index line.  The header may give an indentation
+// indicator and a chomping indicator: - to strip the final line break
+// or + to keep every trailing one.
+func (p *yamlParser) parseBlockScalar(
+	header string,
+	line int,
+) (interface{}, error) {
+	folded := header[0] == '>'
+	chomping := byte(0)
+	contentIndent := -1
+	for _, c := range []byte(stripYAMLComment(header[1:])) {
+		switch {
+		case (c == '-' || c == '+') && chomping == 0:
+			chomping = c
+		case c >= '1' && c <= '9' && contentIndent < 0:
+			contentIndent = p.parentIndent(line) + int(c-'0')
+		default:
+			return nil, p.fail(line, "Invalid block scalar header %s", header)
+		}
+	}
+
+	p.index = line + 1
+	content := []string{}
+	for ; p.index < len(p.lines); p.index++ {
+		raw := p.lines[p.index]
+		if strings.TrimLeft(raw, " ") == "" {
+			content = append(content, "")
+			continue
+		}
+		lineIndent := len(raw) - len(strings.TrimLeft(raw, " "))
+		if contentIndent < 0 {
+			if lineIndent <= p.parentIndent(line) {
+				break
+			}
+			contentIndent = lineIndent
+		}
+		if lineIndent < contentIndent {
+			break
+		}
+		content = append(content, raw[contentIndent:])
+	}
+
+	trailing := 0
+	for trailing < len(content) && content[len(content)-1-trailing] == "" {
+		trailing++
+	}
+	text := joinBlockLines(content[:len(content)-trailing], folded)
+	switch {
+	case chomping == '+':
+		text += strings.Repeat("\n", trailing+1)
+	case chomping == '-' || text == "":
+	default:
+		text += "\n"
+	}
+	return text, nil
+}
+
+// Finds the indentation of the line holding a block scalar's header,
+// which its content must exceed
+func (p *yamlParser) parentIndent(line int) int {
+	raw := p.lines[line]
+	return len(raw) - len(strings.TrimLeft(raw, " "))
+}
+
+// Joins the lines of a block scalar, which for folded scalars turns
+// the break between two lines of text into a space
+func joinBlockLines(lines []string, folded bool) string {
+	var text strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			previous := lines[i-1]
+			previousText := previous != "" && previous[0] != ' '
+			switch {
+			case !folded:
+				text.WriteByte('\n')
+			case previousText && line != "" && line[0] != ' ':
+				text.WriteByte(' ')
+			case previousText && line == "":
+			default:
+				text.WriteByte('\n')
+			}
+		}
+		text.WriteString(line)
+	}
+	return text.String()
+}
+
+// Skips blank and comment lines, along with the --- marker that may
+// start the document, returning false at the end of the document
+func (p *yamlParser) nextContent() bool {
+	for ; p.index < len(p.lines) && !p.ended; p.index++ {
+		line := p.lines[p.index]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+
+		start := strings.HasPrefix(line, "---") &&
+			stripYAMLComment(line[3:]) == ""
+		end := strings.HasPrefix(line, "...") &&
+			stripYAMLComment(line[3:]) == ""
+		if start && !p.started {
+			p.started = true
+			continue
+		}
+		if start || end {
+			p.ended = true
+			p.endMarker = p.index
+			p.index++
+			return false
+		}
+		p.started = true
+		return true
+	}
+	return false
+}
+
+// Splits a line into the number of spaces indenting it and the rest
+func (p *yamlParser) splitIndent(line int) (int, string, error) {
+	raw := strings.TrimRight(p.lines[line], " \t")
+	text := strings.TrimLeft(raw, " ")
+	if strings.HasPrefix(text, "\t") {
+		return 0, "", p.fail(line, "Tabs can't be used for indentation")
+	}
+	return len(raw) - len(text), text, nil
+}
+
+// Records the line, given by its index, that an error was found on
+func (p *yamlParser) fail(
+	line int,
+	format string,
+	args ...interface{},
+) error {
+	p.errorAt = line + 1
+	return fmt.Errorf(format, args...)
+}
+
+// Parses the single-line flow sequences and mappings, such as [a, b]
+// and {a: 1, b: 2}, that may be given in place of a scalar
+type yamlFlowParser struct {
+	text   string
+	pos    int
+	parser *yamlParser
+	line   int
+}
+
+func (f *yamlFlowParser) parseValue(path string) (interface{}, error) {
+	f.skipSpaces()
+	if f.pos >= len(f.text) {
+		return nil, fmt.Errorf("Unterminated flow collection")
+	}
+	switch f.text[f.pos] {
+	case '[':
+		return f.parseSequence(path)
+	case '{':
+		return f.parseMapping(path)
+	}
+	value, rest, err := parseYAMLScalar(f.text[f.pos:], ",]}")
+	f.pos = len(f.text) - len(rest)
+	return value, err
+}
+
+func (f *yamlFlowParser) parseSequence(path string) (interface{}, error) {
+	f.pos++
+	sequence := []interface{}{}
+	for {
+		f.skipSpaces()
+		if f.consume(']') {
+			return sequence, nil
+		}
+		itemPath := fmt.Sprintf("%s[%d]", path, len(sequence))
+		f.parser.valueAt[itemPath] = f.line + 1
+		value, err := f.parseValue(itemPath)
+		if err != nil {
+			return nil, err
+		}
+		sequence = append(sequence, value)
+
+		f.skipSpaces()
+		if f.consume(']') {
+			return sequence, nil
+		}
+		if f.pos >= len(f.text) {
+			return nil, fmt.Errorf("Unterminated flow collection")
+		}
+		if !f.consume(',') {
+			return nil, fmt.Errorf("Expected , or ] in flow sequence")
+		}
+	}
+}
+
+func (f *yamlFlowParser) parseMapping(path string) (interface{}, error) {
+	f.pos++
+	mapping := map[string]interface{}{}
+	for {
+		f.skipSpaces()
+		if f.consume('}') {
+			return mapping, nil
+		}
+		key, rest, err := parseYAMLScalar(f.text[f.pos:], ",]}:")
+		if err != nil {
+			return nil, err
+		}
+		f.pos = len(f.text) - len(rest)
+		keyText, ok := key.(untypedScalar)
+		if !ok {
+			keyText = untypedScalar(fmt.Sprint(key))
+		}
+		keyPath := joinPath(path, string(keyText))
+		if _, ok := mapping[string(keyText)]; ok {
+			return nil, fmt.Errorf("%s is defined twice", keyPath)
+		}
+		if !f.consume(':') {
+			return nil, fmt.Errorf("Expected : after key %s", keyText)
+		}
+		f.parser.valueAt[keyPath] = f.line + 1
+		value, err := f.parseValue(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		mapping[string(keyText)] = value
+
+		f.skipSpaces()
+		if f.consume('}') {
+			return mapping, nil
+		}
+		if f.pos >= len(f.text) {
+			return nil, fmt.Errorf("Unterminated flow collection")
+		}
+		if !f.consume(',') {
+			return nil, fmt.Errorf("Expected , or } in flow mapping")
+		}
+	}
+}
+
+// Expects nothing but a comment after the collection
+func (f *yamlFlowParser) end() error {
+	f.skipSpaces()
+	if f.pos < len(f.text) && f.text[f.pos] != '#' {
+		return fmt.Errorf("Unexpected %s", f.text[f.pos:])
+	}
+	return nil
+}
+
+func (f *yamlFlowParser) skipSpaces() {
+	for f.pos < len(f.text) && f.text[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+func (f *yamlFlowParser) consume(c byte) bool {
+	if f.pos < len(f.text) && f.text[f.pos] == c {
+		f.pos++
+		return true
+	}
+	return false
+}
+
+// Parses a quoted or plain scalar at the start of text, returning the
+// text after it.  Plain scalars end at a comment or at any of the
+// given terminators, and are untyped unless null.
+func parseYAMLScalar(
+	text string,
+	terminators string,
+) (interface{}, string, error) {
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		value, rest, err := parseYAMLQuoted(text)
+		return value, strings.TrimLeft(rest, " "), err
+	}
+
+	end := len(text)
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		comment := c == '#' && (i == 0 || text[i-1] == ' ')
+		if comment || strings.IndexByte(terminators, c) >= 0 {
+			end = i
+			break
+		}
+		if c == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			return nil, "", fmt.Errorf("Unexpected : in %s", text)
+		}
+	}
+	plain := strings.TrimSpace(text[:end])
+	switch plain {
+	case "", "~", "null", "Null", "NULL":
+		return nil, text[end:], nil
+	}
+	return untypedScalar(plain), text[end:], nil
+}
+
+// Parses a single or double-quoted scalar at the start of text,
+// returning the text after it
+func parseYAMLQuoted(text string) (string, string, error) {
+	quote := text[0]
+	var value strings.Builder
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == quote && quote == '\'' && i+1 < len(text) &&
+			text[i+1] == '\'':
+			value.WriteByte('\'')
+			i++
+		case c == quote:
+			return value.String(), text[i+1:], nil
+		case c == '\\' && quote == '"':
+			if i+1 >= len(text) {
+				return "", "", fmt.Errorf("Unterminated string")
+			}
+			length, err := writeYAMLEscape(&value, text[i+1:])
+			if err != nil {
+				return "", "", err
+			}
+			i += length
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("Unterminated string")
+}
+
+var yamlEscapes = map[byte]string{
+	'0':  "\x00",
+	'a':  "\a",
+	'b':  "\b",
+	't':  "\t",
+	'n':  "\n",
+	'v':  "\v",
+	'f':  "\f",
+	'r':  "\r",
+	'e':  "\x1b",
+	' ':  " ",
+	'"':  "\"",
+	'/':  "/",
+	'\\': "\\",
+}
+
+// Writes the character escaped at the start of text, after its
+// backslash, returning the length of the escape
+func writeYAMLEscape(value *strings.Builder, text string) (int, error) {
+	if escaped, ok := yamlEscapes[text[0]]; ok {
+		value.WriteString(escaped)
+		return 1, nil
+	}
+
+	digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[text[0]]
+	if digits == 0 || len(text) <= digits {
+		return 0, fmt.Errorf("Invalid escape \\%c", text[0])
+	}
+	code, err := strconv.ParseUint(text[1:1+digits], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return 0, fmt.Errorf("Invalid escape \\%s", text[:1+digits])
+	}
+	value.WriteRune(rune(code))
+	return 1 + digits, nil
+}
+
+// Parses a mapping key, which may be quoted
+func parseYAMLKey(text string) (string, error) {
+	if text[0] != '"' && text[0] != '\'' {
+		return text, nil
+	}
+	key, rest, err := parseYAMLQuoted(text)
+	if err == nil && strings.TrimSpace(rest) != "" {
+		err = fmt.Errorf("Unexpected %s after key", rest)
+	}
+	return key, err
+}
+
+// Finds the colon ending the key of a mapping entry, or returns -1 if
+// the text isn't one
+func findMappingColon(text string) int {
+	start := 0
+	switch text[0] {
+	case '[', '{', '|', '>', '&', '*', '!':
+		return -1
+	case '"', '\'':
+		_, rest, err := parseYAMLQuoted(text)
+		if err != nil {
+			return -1
+		}
+		start = len(text) - len(rest)
+	}
+	for i := start; i < len(text); i++ {
+		if text[i] == '#' && i > 0 && text[i-1] == ' ' {
+			return -1
+		}
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			return i
+		}
+	}
+	return -1
+}
+
+// Indicates whether a line's text starts a sequence item
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func stripYAMLComment(text string) string {
+	if i := strings.Index(text, "#"); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSpace(text)
+}
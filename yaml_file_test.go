@@ -0,0 +1,245 @@
+/*
+ * Copyright (c) 2014, Robert Bieber
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions
+ * are met:
+ *
+ * Redistributions of source code must retain the above copyright notice,
+ * this list of conditions and the following disclaimer.
+ *
+ * Redistributions in binary form must reproduce the above copyright
+ * notice, this list of conditions and the following disclaimer in the
+ * documentation and/or other materials provided with the distribution.
+ *
+ * Neither the name of the project's author nor the names of its
+ * contributors may be used to endorse or promote products derived from
+ * this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+ * "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+ * LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS
+ * FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+ * HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+ * SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED
+ * TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+ * PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+ * LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+ * NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package conflag
+
+import (
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type YAMLFileSuite struct{}
+
+func TestYAMLFile(t *testing.T) {
+	Suite(&YAMLFileSuite{})
+	TestingT(t)
+}
+
+type yamlTestConfig struct {
+	Port     int
+	Name     string
+	Verbose  bool
+	Motd     string
+	Banner   string
+	Peers    []string
+	Ports    []uint16
+	Labels   map[string]string
+	Database struct {
+		Host     string
+		Replicas []string
+		Pool     struct {
+			Size uint
+		}
+	}
+}
+
+func readYAMLTest(file string) (*Config, error) {
+	config, err := New(&yamlTestConfig{})
+	if err != nil {
+		return nil, err
+	}
+	err = readYAMLConfigFile(
+		config.fields,
+		strings.NewReader(file),
+		configFileSource,
+	)
+	return config, err
+}
+
+func (s *YAMLFileSuite) TestRead(c *C) {
+	file := `
+# Server settings
+---
+port: 8080  # inline comment
+name: "server # one!"
+verbose: yes
+motd: |
+  Hello,
+    world!
+
+banner: >-
+  Welcome to
+  the server
+
+  Enjoy
+peers:
+- a
+- 'b, ''c'''
+ports: [80, 443]
+labels: {env: prod, team name: core}
+database:
+  host: db.local
+  replicas:
+    - first
+    -   second
+  pool:
+    size: 4
+`
+	config, err := readYAMLTest(file)
+	c.Assert(err, IsNil)
+
+	c.Assert(config.fields["Port"].parsedValue, Equals, "8080")
+	c.Assert(config.fields["Name"].parsedValue, Equals, "server # one!")
+	c.Assert(config.fields["Verbose"].parsedValue, Equals, "yes")
+	c.Assert(
+		config.fields["Motd"].parsedValue,
+		Equals,
+		"Hello,\n  world!\n",
+	)
+	c.Assert(
+		config.fields["Banner"].parsedValue,
+		Equals,
+		"Welcome to the server\nEnjoy",
+	)
+	c.Assert(
+		config.fields["Peers"].parsedValues,
+		DeepEquals,
+		[]string{`"a"`, `"b, 'c'"`},
+	)
+	c.Assert(
+		config.fields["Ports"].parsedValues,
+		DeepEquals,
+		[]string{`"80"`, `"443"`},
+	)
+	c.Assert(
+		config.fields["Labels"].parsedValues,
+		DeepEquals,
+		[]string{`"env=prod"`, `"team name=core"`},
+	)
+	c.Assert(config.fields["Database.Host"].parsedValue, Equals, "db.local")
+	c.Assert(
+		config.fields["Database.Replicas"].parsedValues,
+		DeepEquals,
+		[]string{`"first"`, `"second"`},
+	)
+	c.Assert(config.fields["Database.Pool.Size"].parsedValue, Equals, "4")
+}
+
+func (s *YAMLFileSuite) TestBlockScalars(c *C) {
+	cases := map[string]string{
+		"motd: |\n  a\n  b\n\n\nport: 1": "a\nb\n",
+		"motd: |-\n  a\n  b\n":           "a\nb",
+		"motd: |+\n  a\n\n":              "a\n\n",
+		"motd: >\n  a\n  b\n\n  c\n":     "a b\nc\n",
+		"motd: >\n  a\n    b\n  c":       "a\n  b\nc\n",
+		"motd: |2\n    a\n   b\n":        "  a\n b\n",
+		"motd: | # comment\n  # a\n":     "# a\n",
+		"motd: |\nport: 1":               "",
+		"motd: \"a\\tb\\u00e9\\\"\"":     "a\tb\u00e9\"",
+	}
+	for file, expected := range cases {
+		config, err := readYAMLTest(file)
+		c.Assert(err, IsNil, Commentf("%s", file))
+		c.Assert(
+			config.fields["Motd"].parsedValue,
+			Equals,
+			expected,
+			Commentf("%s", file),
+		)
+	}
+}
+
+func (s *YAMLFileSuite) TestTypeErrors(c *C) {
+	cases := map[string]string{
+		"\nport: \"80\"": "conflag: Expected an integer, got a string " +
+			"at port (line 2) in config file.",
+		"name:\n  first: a": "conflag: Expected a string, got a mapping " +
+			"at name (line 1) in config file.",
+		"verbose: [true]": "conflag: Expected a boolean, got an array " +
+			"at verbose (line 1) in config file.",
+		"peers:\n  - a\n  - b: c": "conflag: Expected a string, got a " +
+			"mapping at peers[1] (line 3) in config file.",
+		"labels: {env: [a]}": "conflag: Expected a string, got an array " +
+			"at labels.env (line 1) in config file.",
+		"database:\n  port: 5432": "conflag: Invalid configuration " +
+			"file key at database.port (line 2) in config file.",
+		"- a\n- b": "conflag: Expected a YAML mapping at the top level " +
+			"of config file.",
+	}
+	for file, expected := range cases {
+		_, err := readYAMLTest(file)
+		c.Assert(err, NotNil, Commentf("%s", file))
+		c.Assert(err.Error(), Equals, expected)
+	}
+}
+
+func (s *YAMLFileSuite) TestSyntaxErrors(c *C) {
+	cases := map[string]string{
+		"port: 80\nport: 81":      "line 2 of config file: port is defined twice",
+		"port: 80\n  name: a":     "line 2 of config file: Unexpected indentation",
+		"database:\n\thost: a":    "line 2 of config file: Tabs can't be used for indentation",
+		"name: a: b":              "line 1 of config file: Unexpected : in a: b",
+		"name: \"unterminated":    "line 1 of config file: Unterminated string",
+		"name: 'a' b":             "line 1 of config file: Unexpected b",
+		"name: \"\\q\"":           "line 1 of config file: Invalid escape \\q",
+		"\nports: [1, 2":          "line 2 of config file: Unterminated flow collection",
+		"ports: [[1], 2}":         "line 1 of config file: Expected , or ] in flow sequence",
+		"name: *alias":            "line 1 of config file: Anchors, aliases and tags aren't supported",
+		"motd: |x\n  a":           "line 1 of config file: Invalid block scalar header |x",
+		"port: 80\njust text":     "line 2 of config file: Expected a mapping key",
+		"peers:\n  - a\n  b":      "line 3 of config file: Unexpected indentation",
+		"port: 80\n---\nport: 81": "line 2 of config file: Multiple documents aren't supported",
+	}
+	for file, expected := range cases {
+		_, err := readYAMLTest(file)
+		c.Assert(err, NotNil, Commentf("%s", file))
+		c.Assert(err.Error(), Equals, "conflag: Invalid YAML on "+expected+".")
+	}
+}
+
+func (s *YAMLFileSuite) TestFileFormat(c *C) {
+	dir := c.MkDir()
+	name := filepath.Join(dir, "config.yml")
+	file := "port: 80\npeers: a, b\n...\n"
+	c.Assert(ioutil.WriteFile(name, []byte(file), 0666), IsNil)
+
+	dest := &yamlTestConfig{}
+	config, err := New(dest)
+	c.Assert(err, IsNil)
+	_, err = config.ConfigFile(name).Args([]string{}).Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Port, Equals, 80)
+	c.Assert(dest.Peers, DeepEquals, []string{"a", "b"})
+
+	dest = &yamlTestConfig{}
+	config, err = New(dest)
+	c.Assert(err, IsNil)
+	_, err = config.ConfigReader(strings.NewReader("")).
+		ConfigFormat(YAMLFormat).
+		Args([]string{}).
+		Read()
+	c.Assert(err, IsNil)
+	c.Assert(dest.Port, Equals, 0)
+}